@@ -0,0 +1,74 @@
+package graph
+
+import (
+	"fmt"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Undelivered wraps a state which could not be delivered, or which a
+// handler failed to handle, with the reason. It is emitted by the
+// events unit with the name DeadLetter
+type Undelivered struct {
+	State    State // The original state
+	Err      error // The reason the state was not delivered
+	Attempts int   // Number of times a handler was called
+}
+
+/////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+// DeadLetter is the name of states which could not be delivered,
+// where the state is Undelivered and the value is the original state
+const (
+	DeadLetter = "graph.DeadLetter"
+)
+
+/////////////////////////////////////////////////////////////////////
+// STATE
+
+func (*Undelivered) Name() string {
+	return DeadLetter
+}
+
+func (u *Undelivered) Value() interface{} {
+	return u.State
+}
+
+func (*Undelivered) Priority() Priority {
+	return PriorityLow
+}
+
+/////////////////////////////////////////////////////////////////////
+// ERROR
+
+func (u *Undelivered) Error() string {
+	if u.State == nil {
+		return fmt.Sprint(u.Err)
+	} else {
+		return fmt.Sprintf("%q: %v", u.State.Name(), u.Err)
+	}
+}
+
+// Unwrap returns the reason the state was not delivered
+func (u *Undelivered) Unwrap() error {
+	return u.Err
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (u *Undelivered) String() string {
+	str := "<" + DeadLetter
+	if u.State != nil {
+		str += fmt.Sprintf(" name=%q", u.State.Name())
+	}
+	if u.Err != nil {
+		str += fmt.Sprintf(" err=%q", u.Err.Error())
+	}
+	if u.Attempts > 0 {
+		str += fmt.Sprint(" attempts=", u.Attempts)
+	}
+	return str + ">"
+}
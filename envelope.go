@@ -0,0 +1,55 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Envelope wraps a state with the time it was emitted and the unit
+// which emitted it, and is used by interceptors to enrich states
+type Envelope struct {
+	State
+	Time   time.Time   // Time the state was emitted
+	Source interface{} // Unit which emitted the state, or nil
+}
+
+type sourceKey struct{}
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// WithSource returns a context with the unit which emits states
+// using the context
+func WithSource(ctx context.Context, unit interface{}) context.Context {
+	return context.WithValue(ctx, sourceKey{}, unit)
+}
+
+// SourceFromContext returns the unit which emits states using the
+// context, or nil
+func SourceFromContext(ctx context.Context) interface{} {
+	return ctx.Value(sourceKey{})
+}
+
+// Unwrap returns the state in the envelope
+func (e *Envelope) Unwrap() State {
+	return e.State
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (e *Envelope) String() string {
+	str := "<envelope"
+	str += fmt.Sprintf(" name=%q", e.Name())
+	if e.Time.IsZero() == false {
+		str += fmt.Sprint(" time=", e.Time.Format(time.RFC3339Nano))
+	}
+	if e.Source != nil {
+		str += fmt.Sprintf(" source=%T", e.Source)
+	}
+	return str + ">"
+}
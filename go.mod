@@ -1,6 +1,6 @@
 module github.com/djthorpe/graph
 
-go 1.13
+go 1.21
 
 require (
 	github.com/hashicorp/errwrap v1.1.0 // indirect
@@ -2,9 +2,99 @@ package graph
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 )
 
+/////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+// Names of lifecycle states which are emitted as events whilst
+// the graph is running, where the value of the state is the unit
+const (
+	UnitStarted  = "graph.UnitStarted"  // Run method has been called
+	UnitStopping = "graph.UnitStopping" // Run method has been cancelled
+	UnitStopped  = "graph.UnitStopped"  // Run method has returned
+	UnitFailed   = "graph.UnitFailed"   // Run method has returned an error
+	UnitPaused   = "graph.UnitPaused"   // Unit has been paused
+	UnitResumed  = "graph.UnitResumed"  // Unit has been resumed
+)
+
+// Names of lifecycle states which are emitted as events whilst
+// the graph is running, where the value of the state is the graph
+const (
+	GraphReady    = "graph.GraphReady"    // All Run methods have been called
+	GraphStopping = "graph.GraphStopping" // Units are being drained before cancellation
+)
+
+const (
+	OverflowBlock      Overflow = iota // Block dispatching until the subscriber receives
+	OverflowDropOldest                 // Discard the oldest event in the buffer
+	OverflowDropNewest                 // Discard the event being dispatched
+	OverflowDisconnect                 // Close the channel and stop dispatching
+)
+
+// Priorities of states, where states with a higher priority are
+// dispatched before states with a lower priority which are waiting
+const (
+	PriorityLow    Priority = iota - 1 // Bulk states, such as telemetry
+	PriorityNormal                     // States without a priority
+	PriorityHigh                       // Control states, such as lifecycle events
+)
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	// ErrClosed is returned when emitting an event whilst events
+	// are not being dispatched, during or after shutdown
+	ErrClosed = errors.New("Events closed")
+
+	// ErrNoResponder is returned when making a request for which
+	// no responder has been registered
+	ErrNoResponder = errors.New("No responder")
+
+	// ErrNoSubscriber is the reason a state is a dead letter when
+	// there is no subscriber for the state
+	ErrNoSubscriber = errors.New("No subscriber")
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Overflow is the policy when an event is dispatched to a
+// subscriber with a full buffer
+type Overflow uint
+
+// Priority determines the order in which waiting states are dispatched
+type Priority int
+
+// Subscription defines which events are received by a subscriber
+// and how they are buffered
+type Subscription struct {
+	Topics      []string      // Topics to match, or all events when empty
+	Buffer      int           // Buffer is the size of the channel buffer
+	Overflow    Overflow      // Overflow is the policy when the buffer is full
+	Concurrency int           // Concurrency is the number of goroutines calling a handler
+	Retries     int           // Retries is the number of times a failed handler is called again
+	Backoff     time.Duration // Backoff is the delay before the first retry, doubled for each retry up to a minute
+}
+
+// Handler is called by the events unit for each event received
+// by a subscription, and returns any error
+type Handler func(context.Context, State) error
+
+// Responder is called by the events unit for each request received
+// by a topic, and returns the reply or an error
+type Responder func(context.Context, State) (State, error)
+
+// Interceptor is called by the events unit for each state emitted,
+// before it is dispatched, and returns the state to dispatch. It
+// returns nil to drop the state, or an error which is returned to
+// the emitter
+type Interceptor func(context.Context, State) (State, error)
+
 /////////////////////////////////////////////////////////////////////
 // INTERFACES
 
@@ -21,30 +111,107 @@ type State interface {
 	Value() interface{} // Arbitary value
 }
 
+// Prioritized is implemented by states which are dispatched with a
+// priority other than PriorityNormal
+type Prioritized interface {
+	State
+	Priority() Priority
+}
+
 // Events is used to pass state between units
 type Events interface {
-	// Emit state
+	// Emit state, discarding the state if events are closed
 	Emit(State)
 
+	// EmitContext emits state and returns an error if the context is
+	// done before the state is dispatched, or ErrClosed if events
+	// are closed
+	EmitContext(context.Context, State) error
+
 	// Subscribe to receive all events
 	Subscribe() <-chan State
 
+	// SubscribeTopic to receive events with names matching any of the
+	// topics, or all events if no topics are provided. Topics are
+	// dot-separated, where a "*" segment matches exactly one segment
+	// and a "#" segment matches zero or more segments
+	SubscribeTopic(...string) <-chan State
+
+	// SubscribeWith to receive events matching the subscription, with
+	// a buffered channel and overflow policy
+	SubscribeWith(Subscription) <-chan State
+
 	// Unsubscribe from receiving any events
 	Unsubscribe(<-chan State)
+
+	// Handle calls a handler for each event matching the subscription,
+	// whilst events are running, and returns a function which removes
+	// the handler. Errors and panics are logged when there is a logger,
+	// and returned from Run.
+	Handle(Subscription, Handler) func()
+
+	// Request emits a state and waits for a reply from a responder, or
+	// until the context is done. It returns ErrNoResponder if there is no
+	// responder for the state
+	Request(context.Context, State) (State, error)
+
+	// Respond registers a responder for requests matching a topic, and
+	// returns a function which removes the responder
+	Respond(string, Responder) func()
+
+	// Retain keeps the most recent state for each name matching the
+	// topics, which is received by new subscribers immediately
+	Retain(...string)
+
+	// ClearRetained discards retained states with the names, or all
+	// retained states when called without names
+	ClearRetained(...string)
+
+	// Intercept adds an interceptor to the end of the chain, which is
+	// called in order for each state emitted, and returns a function
+	// which removes the interceptor
+	Intercept(Interceptor) func()
+
+	// Dropped returns the number of events which have not been
+	// received by a subscriber due to the overflow policy
+	Dropped(<-chan State) uint64
+
+	// Stats returns counters for states emitted, delivered and dropped
+	// for each topic and subscriber, and the dispatch latency
+	Stats() EventStats
 }
 
 // Logger provides a simple interface for logging to stderr
 type Logger interface {
 	Print(...interface{})          // Print output logging to stderr
-	Debug(...interface{})          // Print output logging to stderr when debugging
 	Printf(string, ...interface{}) // Print formatted logging to stderr
 	Debugf(string, ...interface{}) // Print formatted logging to stderr when debugging
 
+	// Levelled logging, where arguments which are a Field are logged
+	// as key-value pairs and other arguments form the message
+	Debug(...interface{}) // Log at debug level, when debugging
+	Info(...interface{})  // Log at info level
+	Warn(...interface{})  // Log at warning level
+	Error(...interface{}) // Log at error level
+
+	// With returns a logger which adds fields to every message
+	With(...Field) Logger
+
 	IsDebug() bool      // IsDebug returns true if debug flag is set
 	Test() *testing.T   // Test returns testing context when in a unit test
 	SetTest(*testing.T) // SetTest will set debug to true and if provided the test context
 }
 
+// NamedLogger is a logger which can be scoped to a unit. A unit with
+// a Logger field is injected with the logger named with the type of
+// the unit, such as "mypkg.Store"
+type NamedLogger interface {
+	Logger
+
+	// Named returns a logger which logs with the name of a unit
+	Named(string) Logger
+}
+
 /////////////////////////////////////////////////////////////////////
 // UNITS
 
@@ -60,7 +227,10 @@ type Logger interface {
 type Unit struct{}
 
 // No-op default functions for lifecycle
-func (*Unit) Define(State)              { /* NOOP */ }
-func (*Unit) New(State) error           { /* NOOP */ return nil }
-func (*Unit) Run(context.Context) error { /* NOOP */ return nil }
-func (*Unit) Dispose() error            { /* NOOP */ return nil }
+func (*Unit) Define(State)                 { /* NOOP */ }
+func (*Unit) New(State) error              { /* NOOP */ return nil }
+func (*Unit) Run(context.Context) error    { /* NOOP */ return nil }
+func (*Unit) Drain(context.Context) error  { /* NOOP */ return nil }
+func (*Unit) Pause(context.Context) error  { /* NOOP */ return nil }
+func (*Unit) Resume(context.Context) error { /* NOOP */ return nil }
+func (*Unit) Dispose() error               { /* NOOP */ return nil }
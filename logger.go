@@ -0,0 +1,91 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Level is the severity of a log message
+type Level int
+
+// Field is a key-value pair which is logged with a message. Arguments
+// to the levelled Logger methods which are fields are logged as fields,
+// and other arguments form the message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+/////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+const (
+	LevelDebug Level = iota - 1 // Messages when debugging
+	LevelInfo                   // Informational messages, the default level
+	LevelWarn                   // Unexpected conditions which do not cause failure
+	LevelError                  // Failures
+)
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// F returns a field with a key and value
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+// SplitFields separates the fields from other arguments, returning the
+// message formed from the other arguments and the fields
+func SplitFields(args []interface{}) (string, []Field) {
+	var fields []Field
+	var rest []interface{}
+	for _, arg := range args {
+		if field, ok := arg.(Field); ok {
+			fields = append(fields, field)
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	return fmt.Sprint(rest...), fields
+}
+
+// ParseLevel returns a level from a name such as "debug" or "warn"
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("Invalid log level: %q", name)
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+func (f Field) String() string {
+	return fmt.Sprintf("%v=%v", f.Key, f.Value)
+}
@@ -0,0 +1,541 @@
+package bridge
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/djthorpe/graph"
+	"github.com/djthorpe/graph/pkg/codec"
+	pkg "github.com/djthorpe/graph/pkg/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Bridge forwards states with names matching topics to peers in other
+// processes, and emits states received from peers. Addresses are
+// "unix:<path>" for a Unix domain socket, or "tcp:<host>:<port>" or
+// "<host>:<port>" for a TCP connection. The bridge implements
+// graph.Events by using the events unit.
+type Bridge struct {
+	graph.Unit
+	graph.Events
+
+	Listen  string      // Address to accept connections from peers
+	Connect []string    // Addresses of peers to connect to
+	Topics  []string    // Topics to forward, or all states when empty
+	Codec   codec.Codec // Codec for states, JSON by default
+
+	sync.Mutex
+	id    string
+	seq   uint64 // Sequence number of the last state from this bridge, accessed atomically
+	peers map[*peer]bool
+	seen  map[string]*window
+	out   chan *outgoing
+	done  <-chan struct{}
+}
+
+// list is a flag value for comma-separated values
+type list []string
+
+// peer is a connection to another bridge
+type peer struct {
+	conn net.Conn
+	out  chan []byte
+}
+
+// relay identifies a state received from a peer, with the bridge which
+// first forwarded the state and its sequence number from that bridge
+type relay struct {
+	bridge *Bridge
+	from   *peer
+	origin string
+	seq    uint64
+}
+
+// relayKey is the context key for a state received from a peer
+type relayKey struct{}
+
+// outgoing is a state to forward to peers
+type outgoing struct {
+	graph.State
+	relay
+}
+
+// window records the sequence numbers received from an origin, as the
+// highest sequence number and a bitmap of the sequence numbers before it
+type window struct {
+	max, bits uint64
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// DefaultBuffer is the number of states buffered for each peer
+	DefaultBuffer = 100
+
+	// Delays between reconnecting to a peer
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 5 * time.Second
+
+	// Time allowed for peers to exchange hello frames
+	helloTimeout = 5 * time.Second
+
+	// Number of sequence numbers from an origin which are recorded, so
+	// that states received out of order are emitted
+	windowSize = 64
+)
+
+var (
+	errAddress = errors.New("Invalid address")
+	errInUse   = errors.New("Address in use")
+	errSelf    = errors.New("Connected to self")
+)
+
+/////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+func (b *Bridge) Define(state graph.State) {
+	if flags, ok := state.Value().(*flag.FlagSet); ok {
+		flags.StringVar(&b.Listen, "bridge.listen", b.Listen, "Accept connections from peers on an address")
+		flags.Var((*list)(&b.Connect), "bridge.connect", "Connect to peers at comma-separated addresses")
+		flags.Var((*list)(&b.Topics), "bridge.topics", "Comma-separated topics to forward")
+	}
+}
+
+func (b *Bridge) New(graph.State) error {
+	if b.Codec == nil {
+		b.Codec = codec.JSON{}
+	}
+
+	// Create a random identifier, which prevents loops
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return err
+	} else {
+		b.id = hex.EncodeToString(id[:])
+	}
+
+	// Check addresses
+	for _, addr := range append([]string{b.Listen}, b.Connect...) {
+		if addr == "" {
+			continue
+		}
+		if _, _, err := parseAddr(addr); err != nil {
+			return err
+		}
+	}
+
+	// Return success
+	return nil
+}
+
+func (b *Bridge) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+
+	// Listen for connections from peers, returning any error immediately
+	var listener net.Listener
+	if b.Listen != "" {
+		if l, err := listen(b.Listen); err != nil {
+			return err
+		} else {
+			listener = l
+		}
+	}
+
+	b.Mutex.Lock()
+	b.peers = make(map[*peer]bool)
+	b.seen = make(map[string]*window)
+	b.out, b.done = make(chan *outgoing, DefaultBuffer), ctx.Done()
+	b.Mutex.Unlock()
+
+	// Forward states to peers as they are emitted
+	remove := b.Events.Intercept(b.intercept)
+	defer remove()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.forward(ctx)
+	}()
+
+	// Accept connections from peers
+	if listener != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.accept(ctx, listener)
+		}()
+	}
+
+	// Connect to peers
+	for _, addr := range b.Connect {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			b.dial(ctx, addr)
+		}(addr)
+	}
+
+	// Wait until done and connections to peers are closed
+	<-ctx.Done()
+	wg.Wait()
+
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (b *Bridge) String() string {
+	str := "<bridge"
+	if b.id != "" {
+		str += fmt.Sprintf(" id=%v", b.id)
+	}
+	if b.Listen != "" {
+		str += fmt.Sprintf(" listen=%q", b.Listen)
+	}
+	if len(b.Connect) > 0 {
+		str += fmt.Sprintf(" connect=%q", b.Connect)
+	}
+	if len(b.Topics) > 0 {
+		str += fmt.Sprintf(" topics=%q", b.Topics)
+	}
+	return str + ">"
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// intercept queues states which match the topics to be forwarded to
+// peers, and returns the state unchanged. States emitted by this bridge
+// keep the origin and sequence number they were received with, so that
+// they are relayed to other peers
+func (b *Bridge) intercept(ctx context.Context, s graph.State) (graph.State, error) {
+	if b.match(s.Name()) == false {
+		return s, nil
+	}
+	o := &outgoing{State: s}
+	if r, ok := ctx.Value(relayKey{}).(*relay); ok && r.bridge == b {
+		o.relay = *r
+	} else {
+		o.origin, o.seq = b.id, atomic.AddUint64(&b.seq, 1)
+	}
+
+	b.Mutex.Lock()
+	out, done := b.out, b.done
+	b.Mutex.Unlock()
+	select {
+	case out <- o:
+	case <-done:
+	case <-ctx.Done():
+	}
+	return s, nil
+}
+
+// forward sends states to all peers, except the peer a state was received
+// from. States which cannot be encoded are not forwarded, and states are
+// dropped when a peer cannot keep up
+func (b *Bridge) forward(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case o := <-b.out:
+			data, err := b.Codec.Marshal(o.State)
+			if err != nil {
+				continue
+			}
+			payload := statePayload(o.origin, o.seq, data)
+
+			b.Mutex.Lock()
+			for peer := range b.peers {
+				if peer == o.from {
+					continue
+				}
+				select {
+				case peer.out <- payload:
+				default:
+				}
+			}
+			b.Mutex.Unlock()
+		}
+	}
+}
+
+// accept connections from peers until the context is done
+func (b *Bridge) accept(ctx context.Context, listener net.Listener) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// Close the listener when done
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.serve(ctx, conn)
+		}()
+	}
+}
+
+// dial connects to a peer, and reconnects with a backoff when the
+// connection fails or is closed, until the context is done
+func (b *Bridge) dial(ctx context.Context, addr string) {
+	network, address, _ := parseAddr(addr)
+	dialer := new(net.Dialer)
+	backoff := minBackoff
+	for {
+		if conn, err := dialer.DialContext(ctx, network, address); err == nil {
+			if errors.Is(b.serve(ctx, conn), errSelf) {
+				return
+			}
+			backoff = minBackoff
+		}
+
+		// Wait before reconnecting
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// serve exchanges hello frames with a peer, then sends and receives
+// states until the connection is closed or the context is done
+func (b *Bridge) serve(ctx context.Context, conn net.Conn) error {
+	// Close the connection when done
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-closed:
+		}
+		conn.Close()
+	}()
+
+	// Exchange identifiers
+	conn.SetDeadline(time.Now().Add(helloTimeout))
+	if err := writeFrame(conn, frameHello, []byte(b.id)); err != nil {
+		return err
+	}
+	if kind, payload, err := readFrame(conn); err != nil {
+		return err
+	} else if kind != frameHello {
+		return errFrame
+	} else if string(payload) == b.id {
+		return errSelf
+	}
+	conn.SetDeadline(time.Time{})
+
+	// Register the peer
+	p := &peer{conn, make(chan []byte, DefaultBuffer)}
+	b.Mutex.Lock()
+	b.peers[p] = true
+	b.Mutex.Unlock()
+
+	// Send states in the background
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case payload := <-p.out:
+				if err := writeFrame(conn, frameState, payload); err != nil {
+					conn.Close()
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Receive states until the connection is closed
+	err := b.receive(ctx, p)
+
+	// Unregister the peer and wait for sending to end
+	b.Mutex.Lock()
+	delete(b.peers, p)
+	b.Mutex.Unlock()
+	conn.Close()
+	<-done
+
+	return err
+}
+
+// receive reads states from a peer and emits them, ignoring states
+// which originated from this bridge, have already been received from
+// another peer or don't match the topics
+func (b *Bridge) receive(ctx context.Context, p *peer) error {
+	for {
+		kind, payload, err := readFrame(p.conn)
+		if err != nil {
+			return err
+		} else if kind != frameState {
+			continue
+		}
+		origin, seq, data, err := parseState(payload)
+		if err != nil {
+			return err
+		} else if origin == b.id {
+			continue
+		}
+
+		// Record the sequence number, ignoring states already received
+		b.Mutex.Lock()
+		w, exists := b.seen[origin]
+		if exists == false {
+			w = new(window)
+			b.seen[origin] = w
+		}
+		first := w.add(seq)
+		b.Mutex.Unlock()
+		if first == false {
+			continue
+		}
+
+		s, err := b.Codec.Unmarshal(data)
+		if err != nil || b.match(s.Name()) == false {
+			continue
+		}
+
+		// Emit the state with the origin and sequence number, so that it
+		// is relayed to other peers
+		relay := &relay{b, p, origin, seq}
+		if err := b.Events.EmitContext(context.WithValue(ctx, relayKey{}, relay), s); err != nil {
+			return err
+		}
+	}
+}
+
+// add records a sequence number, and returns false if it has already
+// been recorded or is too old to be recorded
+func (w *window) add(seq uint64) bool {
+	switch {
+	case seq > w.max:
+		if shift := seq - w.max; shift < windowSize {
+			w.bits = w.bits<<shift | 1
+		} else {
+			w.bits = 1
+		}
+		w.max = seq
+		return true
+	case w.max-seq >= windowSize:
+		return false
+	default:
+		bit := uint64(1) << (w.max - seq)
+		if w.bits&bit != 0 {
+			return false
+		}
+		w.bits |= bit
+		return true
+	}
+}
+
+// match returns true if a name matches the topics
+func (b *Bridge) match(name string) bool {
+	if len(b.Topics) == 0 {
+		return true
+	}
+	for _, topic := range b.Topics {
+		if pkg.MatchTopic(topic, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// listen returns a listener for an address, removing any stale
+// Unix domain socket
+func listen(addr string) (net.Listener, error) {
+	network, address, err := parseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		if err := removeStale(address); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// removeStale removes a Unix domain socket which nothing is listening
+// on. It returns an error if there is a file which is not a socket, or
+// a socket which is in use
+func removeStale(address string) error {
+	if info, err := os.Lstat(address); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%w: %q", errInUse, address)
+	}
+	if conn, err := net.Dial("unix", address); err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %q", errInUse, address)
+	}
+	return os.Remove(address)
+}
+
+// parseAddr returns the network and address for an address
+func parseAddr(addr string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		return "unix", strings.TrimPrefix(addr, "unix:"), nil
+	case strings.HasPrefix(addr, "tcp:"):
+		return "tcp", strings.TrimPrefix(addr, "tcp:"), nil
+	case strings.Contains(addr, ":"):
+		return "tcp", addr, nil
+	default:
+		return "", "", fmt.Errorf("%w: %q", errAddress, addr)
+	}
+}
+
+// String returns the values as a comma-separated string
+func (l *list) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set appends comma-separated values
+func (l *list) Set(value string) error {
+	*l = append(*l, split(value)...)
+	return nil
+}
+
+// split returns comma-separated values, ignoring empty values
+func split(value string) []string {
+	var result []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,341 @@
+package bridge_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	graph "github.com/djthorpe/graph"
+	bridge "github.com/djthorpe/graph/pkg/bridge"
+	codec "github.com/djthorpe/graph/pkg/codec"
+	pkg "github.com/djthorpe/graph/pkg/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// STATES
+
+type Reading struct {
+	Topic string
+	Level int
+}
+
+func (r *Reading) Name() string {
+	return r.Topic
+}
+
+func (r *Reading) Value() interface{} {
+	return r.Level
+}
+
+func init() {
+	codec.MustRegister("sensor.a", &Reading{})
+	codec.MustRegister("sensor.b", &Reading{})
+	codec.MustRegister("other", &Reading{})
+}
+
+/////////////////////////////////////////////////////////////////////
+// UNITS
+
+type App struct {
+	graph.Unit
+	graph.Events
+	Bridge *bridge.Bridge
+}
+
+func (this *App) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Bridge_001(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := "unix:" + filepath.Join(dir, "socket")
+
+	// Peer b connects to a before it is listening, and reconnects
+	b, gb := start(t, func(app *App) {
+		app.Bridge.Connect = []string{addr}
+		app.Bridge.Topics = []string{"sensor.#"}
+	})
+	time.Sleep(200 * time.Millisecond)
+	a, ga := start(t, func(app *App) {
+		app.Bridge.Listen = addr
+		app.Bridge.Topics = []string{"sensor.#"}
+	})
+	cha := a.Events.SubscribeWith(graph.Subscription{Buffer: 100})
+	chb := b.Events.SubscribeWith(graph.Subscription{Buffer: 100})
+
+	// Emit states from b until they are received by a
+	if wait(cha, "sensor.a", 1, func() { b.Events.Emit(&Reading{"sensor.a", 1}) }) == nil {
+		t.Fatal("Timeout waiting for a to receive from b")
+	}
+
+	// Emit states from a until they are received by b
+	if wait(chb, "sensor.b", 1, func() { a.Events.Emit(&Reading{"sensor.b", 1}) }) == nil {
+		t.Fatal("Timeout waiting for b to receive from a")
+	}
+
+	// States are not forwarded back to the peer they came from, and
+	// states which don't match the topics are not forwarded
+	b.Events.Emit(&Reading{"other", 2})
+	b.Events.Emit(&Reading{"sensor.a", 2})
+	if names := wait(cha, "sensor.a", 2, nil); names == nil {
+		t.Error("Timeout waiting for a to receive from b")
+	} else {
+		for _, name := range names {
+			if name == "other" {
+				t.Error("Unexpected state at a:", name)
+			}
+		}
+	}
+	if n := count(chb, "sensor.a", 2, 100*time.Millisecond); n != 1 {
+		t.Error("Expected one state at b, got", n)
+	}
+
+	a.Events.Unsubscribe(cha)
+	b.Events.Unsubscribe(chb)
+	for _, g := range []*pkg.Graph{ga, gb} {
+		if err := g.Stop(); err != nil {
+			t.Error(err)
+		}
+		if err := g.Dispose(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// start creates and starts a graph
+func start(t *testing.T, fn func(*App)) (*App, *pkg.Graph) {
+	app := new(App)
+	g := pkg.New(app).(*pkg.Graph)
+	g.Define(pkg.NullState())
+	fn(app)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return app, g
+}
+
+// wait calls a function repeatedly until a state with a name and value
+// is received, and returns the names of all states received, or nil
+// on timeout
+func wait(ch <-chan graph.State, name string, value int, fn func()) []string {
+	var names []string
+	timeout := time.After(5 * time.Second)
+	for {
+		if fn != nil {
+			fn()
+		}
+		select {
+		case evt := <-ch:
+			names = append(names, evt.Name())
+			if evt.Name() == name && evt.Value() == value {
+				return names
+			}
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			return nil
+		}
+	}
+}
+
+// count returns the number of states with a name and value received
+// within a duration
+func count(ch <-chan graph.State, name string, value int, d time.Duration) int {
+	n := 0
+	timeout := time.After(d)
+	for {
+		select {
+		case evt := <-ch:
+			if evt.Name() == name && evt.Value() == value {
+				n++
+			}
+		case <-timeout:
+			return n
+		}
+	}
+}
+
+func Test_Bridge_002(t *testing.T) {
+	// An error listening is returned from Run whilst the graph is running
+	dir, err := ioutil.TempDir("", "bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := "unix:" + filepath.Join(dir, "missing", "socket")
+
+	a, g := start(t, func(app *App) {
+		app.Bridge.Listen = addr
+	})
+	timeout := time.After(5 * time.Second)
+	for status := g.StatusOf(a.Bridge); status.State != pkg.StateFailed; status = g.StatusOf(a.Bridge) {
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for bridge to fail")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if status := g.StatusOf(a.Bridge); status.Err == nil {
+		t.Error("Expected listen error")
+	}
+	if err := g.Stop(); err == nil {
+		t.Error("Expected listen error from Stop")
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Bridge_003(t *testing.T) {
+	// States are relayed across more than one hop, and a state emitted
+	// locally is forwarded even when it is the same as a state received
+	dir, err := ioutil.TempDir("", "bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr1, addr2 := "unix:"+filepath.Join(dir, "socket1"), "unix:"+filepath.Join(dir, "socket2")
+
+	// Peers are connected as a - b - c
+	a, ga := start(t, func(app *App) {
+		app.Bridge.Listen = addr1
+	})
+	_, gb := start(t, func(app *App) {
+		app.Bridge.Listen = addr2
+		app.Bridge.Connect = []string{addr1}
+	})
+	c, gc := start(t, func(app *App) {
+		app.Bridge.Connect = []string{addr2}
+	})
+	cha := a.Events.SubscribeWith(graph.Subscription{Topics: []string{"sensor.#"}, Buffer: 100})
+	chc := c.Events.SubscribeWith(graph.Subscription{Topics: []string{"sensor.#"}, Buffer: 100})
+
+	// Emit states from c until they are received by a through b
+	if wait(cha, "sensor.a", 1, func() { c.Events.Emit(&Reading{"sensor.a", 1}) }) == nil {
+		t.Fatal("Timeout waiting for a to receive from c")
+	}
+	if wait(chc, "sensor.b", 1, func() { a.Events.Emit(&Reading{"sensor.b", 1}) }) == nil {
+		t.Fatal("Timeout waiting for c to receive from a")
+	}
+
+	// A state received by a and the same state emitted by a are both
+	// received by c, and a receives its own state but not the state
+	// from c twice
+	c.Events.Emit(&Reading{"sensor.a", 2})
+	if wait(cha, "sensor.a", 2, nil) == nil {
+		t.Fatal("Timeout waiting for a to receive from c")
+	}
+	a.Events.Emit(&Reading{"sensor.a", 2})
+	if n := count(chc, "sensor.a", 2, 200*time.Millisecond); n != 2 {
+		t.Error("Expected two states at c, got", n)
+	}
+	if n := count(cha, "sensor.a", 2, 100*time.Millisecond); n != 1 {
+		t.Error("Expected one more state at a, got", n)
+	}
+
+	a.Events.Unsubscribe(cha)
+	c.Events.Unsubscribe(chc)
+	for _, g := range []*pkg.Graph{ga, gb, gc} {
+		if err := g.Stop(); err != nil {
+			t.Error(err)
+		}
+		if err := g.Dispose(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func Test_Bridge_004(t *testing.T) {
+	// A stale Unix domain socket is replaced, but a file which is not a
+	// socket, or a socket which is in use, is not removed
+	dir, err := ioutil.TempDir("", "bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Create a file, a socket in use and a stale socket
+	file, inuse, stale := filepath.Join(dir, "file"), filepath.Join(dir, "inuse"), filepath.Join(dir, "stale")
+	if err := ioutil.WriteFile(file, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", inuse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if l, err := net.Listen("unix", stale); err != nil {
+		t.Fatal(err)
+	} else {
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+	}
+
+	for _, test := range []struct {
+		path string
+		ok   bool
+	}{
+		{file, false},
+		{inuse, false},
+		{stale, true},
+	} {
+		a, g := start(t, func(app *App) {
+			app.Bridge.Listen = "unix:" + test.path
+		})
+		if test.ok {
+			// Wait for the bridge to listen
+			conn, err := net.Dial("unix", test.path)
+			for i := 0; i < 100 && err != nil; i++ {
+				time.Sleep(10 * time.Millisecond)
+				conn, err = net.Dial("unix", test.path)
+			}
+			if err != nil {
+				t.Error(test.path, err)
+			} else {
+				conn.Close()
+			}
+		} else {
+			timeout := time.After(5 * time.Second)
+			for status := g.StatusOf(a.Bridge); status.State != pkg.StateFailed; status = g.StatusOf(a.Bridge) {
+				select {
+				case <-timeout:
+					t.Fatal(test.path, "timeout waiting for bridge to fail")
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+			if _, err := os.Lstat(test.path); err != nil {
+				t.Error(test.path, "removed:", err)
+			}
+		}
+		if err := g.Stop(); (err == nil) != test.ok {
+			t.Error(test.path, "unexpected error", err)
+		}
+		if err := g.Dispose(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// The socket in use still accepts connections
+	if conn, err := net.Dial("unix", inuse); err != nil {
+		t.Error(err)
+	} else {
+		conn.Close()
+	}
+}
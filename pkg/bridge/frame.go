@@ -0,0 +1,92 @@
+package bridge
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// Each frame has an eight byte header: a two byte magic number, the
+// version of the framing, the kind of frame and the payload size
+const (
+	frameMagic      = 0x6762 // "gb"
+	frameVersion    = 2
+	frameHeaderSize = 8
+	maxFrameSize    = 1 << 24
+)
+
+// Kinds of frame
+const (
+	frameHello byte = iota + 1 // Payload is the node identifier
+	frameState                 // Payload is the origin, sequence number and encoded state
+)
+
+var (
+	errFrame   = errors.New("Invalid frame")
+	errVersion = errors.New("Unsupported version")
+)
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// writeFrame writes a frame with a payload
+func writeFrame(w io.Writer, kind byte, payload []byte) error {
+	if len(payload) > maxFrameSize {
+		return fmt.Errorf("%w: size %d", errFrame, len(payload))
+	}
+	buf := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint16(buf[0:], frameMagic)
+	buf[2] = frameVersion
+	buf[3] = kind
+	binary.BigEndian.PutUint32(buf[4:], uint32(len(payload)))
+	copy(buf[frameHeaderSize:], payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+// readFrame reads a frame and returns the kind and payload
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	if binary.BigEndian.Uint16(header[0:]) != frameMagic {
+		return 0, nil, errFrame
+	}
+	if header[2] != frameVersion {
+		return 0, nil, fmt.Errorf("%w: %d", errVersion, header[2])
+	}
+	size := binary.BigEndian.Uint32(header[4:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("%w: size %d", errFrame, size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[3], payload, nil
+}
+
+// statePayload returns the payload for a state frame, with the bridge
+// which first forwarded the state and its sequence number from that bridge
+func statePayload(origin string, seq uint64, data []byte) []byte {
+	payload := make([]byte, 0, 1+len(origin)+8+len(data))
+	payload = append(payload, byte(len(origin)))
+	payload = append(payload, origin...)
+	payload = binary.BigEndian.AppendUint64(payload, seq)
+	return append(payload, data...)
+}
+
+// parseState returns the origin, sequence number and encoded state from
+// a state frame
+func parseState(payload []byte) (string, uint64, []byte, error) {
+	if len(payload) == 0 || len(payload) < 1+int(payload[0])+8 {
+		return "", 0, nil, errFrame
+	}
+	n := 1 + int(payload[0])
+	return string(payload[1:n]), binary.BigEndian.Uint64(payload[n:]), payload[n+8:], nil
+}
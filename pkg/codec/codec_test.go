@@ -0,0 +1,106 @@
+package codec_test
+
+import (
+	"errors"
+	"testing"
+
+	codec "github.com/djthorpe/graph/pkg/codec"
+)
+
+/////////////////////////////////////////////////////////////////////
+// STATES
+
+type Reading struct {
+	Sensor string
+	Level  float64
+}
+
+func (*Reading) Name() string {
+	return "sensor.reading"
+}
+
+func (r *Reading) Value() interface{} {
+	return r.Level
+}
+
+type Alarm struct {
+	Level int
+}
+
+func (Alarm) Name() string {
+	return "sensor.alarm"
+}
+
+func (a Alarm) Value() interface{} {
+	return a.Level
+}
+
+type Unknown struct{}
+
+func (Unknown) Name() string {
+	return "unknown"
+}
+
+func (Unknown) Value() interface{} {
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Codec_001(t *testing.T) {
+	// States are marshalled and unmarshalled into registered types
+	r := codec.NewRegistry()
+	if err := r.Register("sensor.alarm", Alarm{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("sensor.alarm", &Alarm{}); errors.Is(err, codec.ErrDuplicate) == false {
+		t.Error("Expected ErrDuplicate, got", err)
+	}
+
+	for _, c := range []codec.Codec{codec.JSON{r}, codec.Gob{r}} {
+		data, err := c.Marshal(Alarm{Level: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state, err := c.Unmarshal(data); err != nil {
+			t.Error(err)
+		} else if alarm, ok := state.(Alarm); ok == false || alarm.Level != 3 {
+			t.Errorf("Unexpected state %#v", state)
+		}
+
+		// Unregistered types return errors
+		if _, err := c.Marshal(Unknown{}); errors.Is(err, codec.ErrUnregistered) == false {
+			t.Error("Expected ErrUnregistered, got", err)
+		}
+		if _, err := c.Marshal(&Alarm{}); errors.Is(err, codec.ErrUnregistered) == false {
+			t.Error("Expected ErrUnregistered, got", err)
+		}
+		if _, err := c.Marshal(nil); errors.Is(err, codec.ErrUnregistered) == false {
+			t.Error("Expected ErrUnregistered, got", err)
+		}
+	}
+
+	// Unmarshal with a registry without the type
+	data, err := codec.JSON{r}.Marshal(Alarm{Level: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (codec.JSON{codec.NewRegistry()}).Unmarshal(data); errors.Is(err, codec.ErrUnregistered) == false {
+		t.Error("Expected ErrUnregistered, got", err)
+	}
+}
+
+func Test_Codec_002(t *testing.T) {
+	// Marshal and Unmarshal use the default registry
+	codec.MustRegister("sensor.reading", &Reading{})
+	data, err := codec.Marshal(&Reading{"a", 1.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state, err := codec.Unmarshal(data); err != nil {
+		t.Error(err)
+	} else if reading, ok := state.(*Reading); ok == false || reading.Sensor != "a" || reading.Level != 1.5 {
+		t.Errorf("Unexpected state %#v", state)
+	}
+}
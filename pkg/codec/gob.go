@@ -0,0 +1,53 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Gob marshals states as the state name followed by the gob encoded
+// state, using the default registry when Registry is nil
+type Gob struct {
+	*Registry
+}
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+func (c Gob) Marshal(state graph.State) ([]byte, error) {
+	r, state := registry(c.Registry), unwrap(state)
+	if err := r.check(state); err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	enc := gob.NewEncoder(buf)
+	if err := enc.Encode(state.Name()); err != nil {
+		return nil, err
+	}
+	if err := enc.Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c Gob) Unmarshal(data []byte) (graph.State, error) {
+	r := registry(c.Registry)
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	var name string
+	if err := dec.Decode(&name); err != nil {
+		return nil, err
+	}
+	ptr, state, err := r.alloc(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := dec.Decode(ptr); err != nil {
+		return nil, err
+	}
+	return state(), nil
+}
@@ -0,0 +1,52 @@
+package codec
+
+import (
+	"encoding/json"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// JSON marshals states as JSON objects with the state name and the
+// encoded state, using the default registry when Registry is nil
+type JSON struct {
+	*Registry
+}
+
+type jsonEnvelope struct {
+	Name  string          `json:"name"`
+	State json.RawMessage `json:"state"`
+}
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+func (c JSON) Marshal(state graph.State) ([]byte, error) {
+	r, state := registry(c.Registry), unwrap(state)
+	if err := r.check(state); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(&jsonEnvelope{state.Name(), data})
+}
+
+func (c JSON) Unmarshal(data []byte) (graph.State, error) {
+	r := registry(c.Registry)
+	var envelope jsonEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	ptr, state, err := r.alloc(envelope.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(envelope.State, ptr); err != nil {
+		return nil, err
+	}
+	return state(), nil
+}
@@ -0,0 +1,167 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Codec marshals states so they can be written to disk or the wire,
+// and unmarshals them into the concrete type registered for the name
+type Codec interface {
+	Marshal(graph.State) ([]byte, error)
+	Unmarshal([]byte) (graph.State, error)
+}
+
+// Registry maps state names to concrete types
+type Registry struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	// ErrUnregistered is returned when marshalling or unmarshalling a
+	// state whose name or type is not registered
+	ErrUnregistered = errors.New("Unregistered state")
+
+	// ErrDuplicate is returned when registering a name twice with
+	// different types
+	ErrDuplicate = errors.New("Duplicate state")
+
+	// DefaultRegistry is used by codecs without a registry
+	DefaultRegistry = NewRegistry()
+)
+
+/////////////////////////////////////////////////////////////////////
+// NEW
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{types: make(map[string]reflect.Type)}
+}
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Register maps a state name to the type of a state in the default
+// registry
+func Register(name string, state graph.State) error {
+	return DefaultRegistry.Register(name, state)
+}
+
+// MustRegister maps a state name to the type of a state in the default
+// registry, and panics on error
+func MustRegister(name string, state graph.State) {
+	if err := Register(name, state); err != nil {
+		panic(err)
+	}
+}
+
+// Marshal returns a state encoded as JSON, using the default registry
+func Marshal(state graph.State) ([]byte, error) {
+	return JSON{}.Marshal(state)
+}
+
+// Unmarshal returns a state decoded from JSON, using the default registry
+func Unmarshal(data []byte) (graph.State, error) {
+	return JSON{}.Unmarshal(data)
+}
+
+// Register maps a state name to the type of a state. It returns an
+// error if the name is already registered with a different type
+func (r *Registry) Register(name string, state graph.State) error {
+	r.RWMutex.Lock()
+	defer r.RWMutex.Unlock()
+
+	if state == nil {
+		return fmt.Errorf("%w: %q", ErrUnregistered, name)
+	}
+	t := reflect.TypeOf(state)
+	if other, exists := r.types[name]; exists && other != t {
+		return fmt.Errorf("%w: %q", ErrDuplicate, name)
+	}
+	r.types[name] = t
+	return nil
+}
+
+// Names returns the registered state names
+func (r *Registry) Names() []string {
+	r.RWMutex.RLock()
+	defer r.RWMutex.RUnlock()
+
+	result := make([]string, 0, len(r.types))
+	for name := range r.types {
+		result = append(result, name)
+	}
+	return result
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// registry returns the default registry if r is nil
+func registry(r *Registry) *Registry {
+	if r == nil {
+		return DefaultRegistry
+	} else {
+		return r
+	}
+}
+
+// unwrap returns the state in an envelope, so that interceptors which
+// enrich states don't prevent them from being marshalled
+func unwrap(state graph.State) graph.State {
+	if envelope, ok := state.(*graph.Envelope); ok {
+		return envelope.State
+	} else {
+		return state
+	}
+}
+
+// check returns an error if the type of a state is not registered
+// for its name
+func (r *Registry) check(state graph.State) error {
+	r.RWMutex.RLock()
+	defer r.RWMutex.RUnlock()
+
+	if state == nil {
+		return fmt.Errorf("%w: <nil>", ErrUnregistered)
+	}
+	if t, exists := r.types[state.Name()]; exists == false || t != reflect.TypeOf(state) {
+		return fmt.Errorf("%w: %q", ErrUnregistered, state.Name())
+	}
+	return nil
+}
+
+// alloc returns a pointer to a zero value for the registered type of
+// a name, and a function which returns the state once decoded
+func (r *Registry) alloc(name string) (interface{}, func() graph.State, error) {
+	r.RWMutex.RLock()
+	t, exists := r.types[name]
+	r.RWMutex.RUnlock()
+	if exists == false {
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnregistered, name)
+	}
+
+	// Decode into a pointer for both pointer and value types
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		return v.Interface(), func() graph.State {
+			return v.Interface().(graph.State)
+		}, nil
+	} else {
+		v := reflect.New(t)
+		return v.Interface(), func() graph.State {
+			return v.Elem().Interface().(graph.State)
+		}, nil
+	}
+}
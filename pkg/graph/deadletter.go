@@ -0,0 +1,46 @@
+package graph
+
+import (
+	"strings"
+	"time"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// graphPrefix is the prefix for states emitted by the graph, which
+// are not dead letters
+const (
+	graphPrefix = "graph."
+)
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// deadLetter emits a state which could not be delivered with the
+// reason, without waiting. The dead letter is discarded when the lane
+// is full, so that the dispatcher and handlers are not blocked
+func (p *events) deadLetter(s graph.State, err error, attempts int) {
+	if r, ok := s.(*request); ok {
+		s = r.State
+	}
+	if s == nil || strings.HasPrefix(s.Name(), graphPrefix) {
+		return
+	}
+
+	p.RWMutex.RLock()
+	lanes, closed := p.lanes, p.closed
+	p.RWMutex.RUnlock()
+	if lanes == nil {
+		return
+	}
+
+	evt := &graph.Undelivered{State: s, Err: err, Attempts: attempts}
+	select {
+	case <-closed:
+	case lanes[lane(evt)] <- queued{evt, time.Time{}}:
+	default:
+	}
+}
@@ -0,0 +1,266 @@
+package graph
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// snapshot is an immutable view of the subscribers, which is replaced
+// whenever subscribers change, so that states can be dispatched
+// without holding the lock
+type snapshot struct {
+	shards []*index // Index of subscribers for each shard
+	retain bool     // True if any topics are retained
+	dead   bool     // True if any subscriber receives dead letters
+}
+
+// shard dispatches states to a subset of subscribers, so that a slow
+// subscriber only delays other subscribers in the same shard
+type shard struct {
+	q chan *batch // Created each time dispatching starts
+}
+
+// batch is a sequence of states which are dispatched by every shard
+type batch struct {
+	items []item
+	refs  int32 // Number of shards which have not dispatched the batch
+}
+
+// item is a state with the subscribers when it was accepted, the time
+// it was emitted and the counters for the state name
+type item struct {
+	state    graph.State
+	snapshot *snapshot
+	time     time.Time
+	counters *counters
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// maxShards is the maximum number of shards
+	maxShards = 8
+
+	// batchSize is the maximum number of states in a batch
+	batchSize = 64
+)
+
+var (
+	batches = sync.Pool{
+		New: func() interface{} {
+			return &batch{items: make([]item, 0, batchSize)}
+		},
+	}
+)
+
+/////////////////////////////////////////////////////////////////////
+// NEW
+
+// newShards returns a shard for each processor, up to maxShards
+func newShards() []*shard {
+	n := runtime.GOMAXPROCS(0)
+	if n > maxShards {
+		n = maxShards
+	}
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = new(shard)
+	}
+	return shards
+}
+
+// newSnapshot returns a snapshot which indexes subscribers by shard
+func newSnapshot(subs []*subscriber, shards int, retain bool) *snapshot {
+	s := &snapshot{shards: make([]*index, shards), retain: retain}
+	for i := range s.shards {
+		var shard []*subscriber
+		for _, sub := range subs {
+			if sub.shard == i {
+				shard = append(shard, sub)
+			}
+		}
+		s.shards[i] = newIndex(shard)
+	}
+	s.dead = s.has(graph.DeadLetter)
+	return s
+}
+
+// has returns true if any subscriber matches a name
+func (s *snapshot) has(name string) bool {
+	for _, index := range s.shards {
+		if index.has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// dispatchAll reads batches of states from the lanes and passes them
+// to every shard until the context is done. States which were accepted
+// before events closed are then passed to every shard, before the
+// shards end
+func (p *events) dispatchAll(ctx context.Context) {
+	// With a single shard, dispatch without passing batches to a
+	// separate goroutine
+	if len(p.shards) == 1 {
+		for b := p.batch(ctx); b != nil; b = p.batch(ctx) {
+			p.dispatchBatch(ctx, 0, b)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i, s := range p.shards {
+		s.q = make(chan *batch, 1)
+		wg.Add(1)
+		go func(i int, q <-chan *batch) {
+			defer wg.Done()
+			for b := range q {
+				p.dispatchBatch(ctx, i, b)
+			}
+		}(i, s.q)
+	}
+
+	for b := p.batch(ctx); b != nil; b = p.batch(ctx) {
+		for _, s := range p.shards {
+			s.q <- b
+		}
+	}
+	for _, s := range p.shards {
+		close(s.q)
+	}
+
+	wg.Wait()
+}
+
+// batch waits for a state, and returns a batch of states which are
+// waiting to be dispatched, highest priority first. Once the context is
+// done, events are closed and batches of the states which were accepted
+// are returned, and nil is returned when no state is waiting
+func (p *events) batch(ctx context.Context) *batch {
+	q, err := next(ctx, p.lanes)
+	if err != nil {
+		p.shutdown()
+		q = poll(p.lanes)
+	}
+	if q.state == nil {
+		return nil
+	}
+
+	b := batches.Get().(*batch)
+	b.refs = int32(len(p.shards))
+	for q.state != nil {
+		b.items = append(b.items, p.item(q))
+		if len(b.items) == batchSize {
+			break
+		}
+		q = poll(p.lanes)
+	}
+	return b
+}
+
+// item returns a state with the current snapshot of subscribers, and
+// retains and counts the state if necessary
+func (p *events) item(q queued) item {
+	var c *counters
+	switch evt := q.state.(type) {
+	case *barrier:
+		evt.refs = int32(len(p.shards))
+	case *replay:
+		// Retained states are not counted again
+	default:
+		c = p.counters(evt.Name())
+		atomic.AddUint64(&c.emitted, 1)
+	}
+
+	current := p.snapshot.Load().(*snapshot)
+	if current.retain {
+		p.RWMutex.Lock()
+		p.retainState(q.state)
+		current = p.snapshot.Load().(*snapshot)
+		p.RWMutex.Unlock()
+	}
+
+	// States without a subscriber are dead letters
+	if c != nil && current.dead && current.has(q.state.Name()) == false {
+		p.deadLetter(q.state, graph.ErrNoSubscriber, 0)
+	}
+
+	return item{q.state, current, q.time, c}
+}
+
+// dispatchBatch dispatches a batch of states to subscribers in a shard,
+// and releases the batch
+func (p *events) dispatchBatch(ctx context.Context, i int, b *batch) {
+	for _, item := range b.items {
+		p.dispatch(ctx, i, item)
+	}
+	p.release(b)
+}
+
+// release returns a batch to the pool once every shard has dispatched
+// it, and records the latency of states in the batch which were sampled
+func (p *events) release(b *batch) {
+	if atomic.AddInt32(&b.refs, -1) == 0 {
+		var now time.Time
+		for i := range b.items {
+			if t := b.items[i].time; t.IsZero() == false && b.items[i].counters != nil {
+				if now.IsZero() {
+					now = time.Now()
+				}
+				p.latency.record(now.Sub(t))
+			}
+			b.items[i] = item{}
+		}
+		b.items = b.items[:0]
+		batches.Put(b)
+	}
+}
+
+// dispatch sends a state to matching subscribers in a shard. The lock
+// is not held whilst sending, so subscribers can unsubscribe whilst
+// blocked
+func (p *events) dispatch(ctx context.Context, i int, item item) {
+	switch evt := item.state.(type) {
+	case *barrier:
+		// A barrier is released once all previous states are dispatched
+		// by every shard
+		if atomic.AddInt32(&evt.refs, -1) == 0 {
+			close(evt.done)
+		}
+	case *replay:
+		// A replay sends retained states to a new subscriber
+		if evt.s.shard == i && p.replay(ctx, evt.s) == false {
+			p.disconnect(evt.s)
+		}
+	default:
+		item.snapshot.shards[i].each(evt.Name(), func(s *subscriber) {
+			if p.replay(ctx, s) == false {
+				atomic.AddUint64(&item.counters.dropped, 1)
+				p.disconnect(s)
+				return
+			}
+			switch s.send(ctx, evt) {
+			case delivered:
+				atomic.AddUint64(&item.counters.delivered, 1)
+			case dropped:
+				atomic.AddUint64(&item.counters.dropped, 1)
+			case disconnected:
+				atomic.AddUint64(&item.counters.dropped, 1)
+				p.disconnect(s)
+			}
+		})
+	}
+}
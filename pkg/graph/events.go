@@ -2,7 +2,10 @@ package graph
 
 import (
 	"context"
+	"flag"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/djthorpe/graph"
 )
@@ -14,15 +17,64 @@ type events struct {
 	graph.Unit
 	sync.RWMutex
 
-	q  chan graph.State
-	ch []chan graph.State
+	// Logger reports handler errors as they occur, when there is a
+	// logger in the graph
+	Logger graph.Logger
+
+	lanes    []chan queued
+	shards   []*shard
+	subs     []*subscriber
+	gone     map[<-chan graph.State]*subscriber
+	snapshot atomic.Value // *snapshot
+	seq      int
+	closed   chan struct{}
+	running  chan struct{}
+	senders  sync.WaitGroup
+	disposed bool
+	handlers []*handler
+	ctx      context.Context
+	wg       sync.WaitGroup
+	errs     *Error
+
+	// Requests and responders
+	id         uint64
+	pending    map[uint64]chan *reply
+	responders []*responder
+
+	// Retained states
+	retain   []*topic
+	retained map[string]graph.State
+
+	// Interceptors, called in order
+	chain []*interceptor
+
+	// Statistics, and the interval for emitting them
+	topics   sync.Map // map[string]*counters
+	ntopics  int32    // Accessed atomically
+	latency  *histogram
+	sample   uint32 // Accessed atomically
+	interval time.Duration
 }
 
 /////////////////////////////////////////////////////////////////////
 // LIFECYCLE
 
+func (p *events) Define(state graph.State) {
+	if flags, ok := state.Value().(*flag.FlagSet); ok {
+		flags.DurationVar(&p.interval, "events.stats", p.interval, "Interval for emitting event statistics, or zero to disable")
+	}
+}
+
 func (p *events) New(graph.State) error {
-	p.q = make(chan graph.State)
+	p.lanes = newLanes()
+	p.shards = newShards()
+	p.gone = make(map[<-chan graph.State]*subscriber)
+	p.pending = make(map[uint64]chan *reply)
+	p.retained = make(map[string]graph.State)
+	p.snapshot.Store(newSnapshot(nil, len(p.shards), false))
+	p.closed = make(chan struct{})
+	p.running = make(chan struct{})
+	p.latency = new(histogram)
 	return nil
 }
 
@@ -30,64 +82,281 @@ func (p *events) Dispose() error {
 	p.RWMutex.Lock()
 	defer p.RWMutex.Unlock()
 
-	close(p.q)
-	for _, ch := range p.ch {
-		if ch != nil {
-			close(ch)
-		}
+	// Close events and release any emitters
+	if p.disposed == false {
+		p.close()
+		p.disposed = true
 	}
-	p.q = nil
-	p.ch = nil
+	for _, s := range p.subs {
+		s.close()
+	}
+	p.lanes = nil
+	p.subs = nil
+	p.gone = nil
+	p.snapshot.Store(newSnapshot(nil, len(p.shards), false))
+	p.handlers = nil
+	p.responders = nil
+	p.chain = nil
+	p.retained = make(map[string]graph.State)
+	p.topics.Range(func(name, _ interface{}) bool {
+		p.topics.Delete(name)
+		return true
+	})
+	atomic.StoreInt32(&p.ntopics, 0)
 
 	return nil
 }
 
 func (p *events) Run(ctx context.Context) error {
-	for {
-		select {
-		case evt := <-p.q:
-			p.RWMutex.RLock()
-			for _, ch := range p.ch {
-				if ch != nil {
-					ch <- evt
-				}
-			}
-			p.RWMutex.RUnlock()
-		case <-ctx.Done():
-			return ctx.Err()
-		}
+	// Open events and start handlers
+	p.RWMutex.Lock()
+	p.open()
+	close(p.running)
+	p.ctx, p.errs = ctx, new(Error)
+	for _, h := range p.handlers {
+		p.start(ctx, h)
+	}
+	if p.interval > 0 {
+		p.wg.Add(1)
+		go p.emitStats(ctx, p.interval)
 	}
+	p.RWMutex.Unlock()
+
+	// Dispatch until done
+	p.dispatchAll(ctx)
+
+	return p.stop(ctx)
 }
 
 /////////////////////////////////////////////////////////////////////
 // PUBLIC METHODS
 
 func (p *events) Subscribe() <-chan graph.State {
+	return p.SubscribeWith(graph.Subscription{})
+}
+
+func (p *events) SubscribeTopic(topics ...string) <-chan graph.State {
+	return p.SubscribeWith(graph.Subscription{Topics: topics})
+}
+
+func (p *events) SubscribeWith(subscription graph.Subscription) <-chan graph.State {
 	p.RWMutex.Lock()
 	defer p.RWMutex.Unlock()
 
-	ch := make(chan graph.State)
-	p.ch = append(p.ch, ch)
-	return ch
+	s := newSubscriber(subscription)
+	s.shard, p.seq = p.seq%len(p.shards), p.seq+1
+	s.retained = p.retainedFor(s)
+	p.subs = append(p.subs, s)
+	p.update()
+
+	// Dispatch retained states to the subscriber
+	if len(s.retained) > 0 {
+		go p.EmitContext(context.Background(), &replay{s})
+	}
+
+	return s.ch
 }
 
 func (p *events) Unsubscribe(ch <-chan graph.State) {
-	p.RWMutex.Lock()
-	defer p.RWMutex.Unlock()
+	if s := p.unsubscribe(ch); s != nil {
+		s.close()
+	}
+}
+
+func (p *events) Dropped(ch <-chan graph.State) uint64 {
+	p.RWMutex.RLock()
+	defer p.RWMutex.RUnlock()
 
-	for i, other := range p.ch {
-		if other == ch {
-			close(other)
-			p.ch[i] = nil
+	for _, s := range p.subs {
+		if s.ch == ch {
+			return s.Dropped()
 		}
 	}
+	if s, exists := p.gone[ch]; exists {
+		return s.Dropped()
+	}
+	return 0
 }
 
 func (p *events) Emit(s graph.State) {
+	p.EmitContext(context.Background(), s)
+}
+
+func (p *events) EmitContext(ctx context.Context, s graph.State) error {
 	// Use NullState when evt is nil
 	if s == nil {
-		p.q <- NullState()
+		s = NullState()
+	}
+
+	// Call interceptors, which may drop the state
+	if internal(s) == false {
+		if state, err := p.intercept(ctx, s); err != nil {
+			return err
+		} else if state == nil {
+			return nil
+		} else {
+			s = state
+		}
+	}
+	return p.send(ctx, s)
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// send queues a state for dispatch, once dispatching has started
+func (p *events) send(ctx context.Context, s graph.State) error {
+	p.RWMutex.RLock()
+	lanes, closed, running := p.lanes, p.closed, p.running
+
+	// Return without waiting when closed, otherwise count the emitter
+	// so that the state is dispatched if it is accepted whilst closing
+	select {
+	case <-closed:
+		p.RWMutex.RUnlock()
+		return graph.ErrClosed
+	default:
+		p.senders.Add(1)
+		defer p.senders.Done()
+	}
+	p.RWMutex.RUnlock()
+
+	// Wait for dispatching to start
+	select {
+	case <-running:
+	case <-closed:
+		return graph.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Emitting after dispose is the same as emitting when closed
+	var q chan queued
+	if lanes != nil {
+		q = lanes[lane(s)]
+	}
+
+	// Sample the time that states are emitted, to measure latency
+	var t time.Time
+	if atomic.AddUint32(&p.sample, 1)%latencySample == 0 {
+		t = time.Now()
+	}
+
+	select {
+	case q <- queued{s, t}:
+		return nil
+	case <-closed:
+		return graph.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// update replaces the snapshot of subscribers. It should be called
+// whilst holding the lock
+func (p *events) update() {
+	p.snapshot.Store(newSnapshot(p.subs, len(p.shards), len(p.retain) > 0))
+}
+
+// sync waits until all events emitted before sync was called have
+// been dispatched to subscribers
+func (p *events) sync(ctx context.Context) error {
+	barrier := &barrier{done: make(chan struct{})}
+	if err := p.EmitContext(ctx, barrier); err != nil {
+		return err
+	}
+	select {
+	case <-barrier.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// unsubscribe removes a subscriber and returns it, or returns nil
+// if the channel is not subscribed
+func (p *events) unsubscribe(ch <-chan graph.State) *subscriber {
+	p.RWMutex.Lock()
+	defer p.RWMutex.Unlock()
+
+	// Release a disconnected subscriber
+	if s, exists := p.gone[ch]; exists {
+		delete(p.gone, ch)
+		return s
+	}
+
+	for i, s := range p.subs {
+		if s.ch == ch {
+			p.subs = append(p.subs[:i], p.subs[i+1:]...)
+			p.update()
+			return s
+		}
+	}
+	return nil
+}
+
+// open allows events to be emitted once dispatching starts, unless
+// the unit has been disposed. It should be called whilst holding the lock
+func (p *events) open() {
+	select {
+	case <-p.closed:
+		if p.disposed == false {
+			p.closed = make(chan struct{})
+		}
+	default:
+		// Already open
+	}
+}
+
+// close releases emitters and returns ErrClosed until open is called.
+// It should be called whilst holding the lock
+func (p *events) close() {
+	select {
+	case <-p.closed:
+		// Already closed
+	default:
+		close(p.closed)
+	}
+}
+
+// shutdown closes events, and waits for emitters which are accepting
+// a state, so that no more states are accepted once it returns
+func (p *events) shutdown() {
+	p.RWMutex.Lock()
+	p.close()
+	p.RWMutex.Unlock()
+	p.senders.Wait()
+}
+
+// stop closes events when dispatching ends and waits for handlers to
+// return. It returns any handler errors, or the context error
+func (p *events) stop(ctx context.Context) error {
+	p.RWMutex.Lock()
+	p.close()
+	p.ctx = nil
+	p.running = make(chan struct{})
+	p.RWMutex.Unlock()
+
+	// Wait for handlers to end
+	p.wg.Wait()
+
+	if err := p.errs.ErrorOrNil(); err != nil {
+		return err
 	} else {
-		p.q <- s
+		return ctx.Err()
+	}
+}
+
+// disconnect closes a subscriber which has overflowed, retaining
+// it until Unsubscribe is called so dropped events can be counted
+func (p *events) disconnect(s *subscriber) {
+	if p.unsubscribe(s.ch) == nil {
+		return
 	}
+
+	p.RWMutex.Lock()
+	p.gone[s.ch] = s
+	p.RWMutex.Unlock()
+
+	s.close()
 }
@@ -2,17 +2,84 @@ package graph_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	graph "github.com/djthorpe/graph"
 	pkg "github.com/djthorpe/graph/pkg/graph"
+	tool "github.com/djthorpe/graph/pkg/tool"
 )
 
+/////////////////////////////////////////////////////////////////////
+// EVENT
+
+type event struct {
+	name string
+}
+
+func (e *event) Name() string {
+	return e.name
+}
+
+func (e *event) Value() interface{} {
+	return nil
+}
+
+type message struct {
+	name  string
+	value interface{}
+}
+
+func (m *message) Name() string {
+	return m.name
+}
+
+func (m *message) Value() interface{} {
+	return m.value
+}
+
+type priority struct {
+	event
+	priority graph.Priority
+}
+
+func (p *priority) Priority() graph.Priority {
+	return p.priority
+}
+
 /////////////////////////////////////////////////////////////////////
 // UNITS
 
+type T struct {
+	graph.Unit
+	graph.Events
+}
+
+func (this *T) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+type S struct {
+	graph.Unit
+	graph.Events
+}
+
+func (this *S) Run(ctx context.Context) error {
+	if err := this.Events.EmitContext(ctx, &event{"hello"}); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
 type E struct {
 	graph.Unit
 	graph.Events
@@ -44,7 +111,11 @@ func (this *E) Run(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-ch:
+		case evt := <-ch:
+			// Count null events, ignoring lifecycle events
+			if evt.Name() != pkg.NullState().Name() {
+				continue
+			}
 			i++
 			if i == n {
 				fmt.Println("got all", n, "events")
@@ -64,7 +135,11 @@ func (this *R) Run(ctx context.Context) error {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-ch:
+		case evt := <-ch:
+			// Count null events, ignoring lifecycle events
+			if evt.Name() != pkg.NullState().Name() {
+				continue
+			}
 			i++
 			if i == n {
 				fmt.Println("got all", n, "events")
@@ -76,9 +151,71 @@ func (this *R) Run(ctx context.Context) error {
 
 func (this *W) Run(ctx context.Context) error {
 	n := 100
-	for i := 0 i < n; i++ {
+	for i := 0; i < n; i++ {
 		this.Events.Emit(nil)
 	}
+	return nil
+}
+
+// recorder is the logger unit in tests, which records messages
+// logged at error level with the name of the unit
+type recorder struct {
+	graph.Unit
+	sync.Mutex
+	errors []string
+}
+
+// named is a recorder for a unit
+type named struct {
+	*recorder
+	name string
+}
+
+func init() {
+	graph.MustRegisterUnit(reflect.TypeOf(&recorder{}), reflect.TypeOf((*graph.Logger)(nil)))
+}
+
+func (r *recorder) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (*recorder) Print(...interface{})          {}
+func (*recorder) Printf(string, ...interface{}) {}
+func (*recorder) Debugf(string, ...interface{}) {}
+func (*recorder) Debug(...interface{})          {}
+func (*recorder) Info(...interface{})           {}
+func (*recorder) Warn(...interface{})           {}
+func (*recorder) IsDebug() bool                 { return false }
+func (*recorder) Test() *testing.T              { return nil }
+func (*recorder) SetTest(*testing.T)            {}
+
+func (r *recorder) Error(args ...interface{}) {
+	r.record("", args)
+}
+
+func (r *recorder) With(...graph.Field) graph.Logger {
+	return r
+}
+
+func (r *recorder) Named(name string) graph.Logger {
+	return &named{r, name}
+}
+
+func (r *named) Error(args ...interface{}) {
+	r.record(r.name, args)
+}
+
+func (r *recorder) record(name string, args []interface{}) {
+	r.Lock()
+	defer r.Unlock()
+	r.errors = append(r.errors, strings.TrimSpace(fmt.Sprintln(append([]interface{}{name}, args...)...)))
+}
+
+func (r *recorder) Errors() []string {
+	r.Lock()
+	defer r.Unlock()
+	return append([]string(nil), r.errors...)
 }
 
 /////////////////////////////////////////////////////////////////////
@@ -115,3 +252,1192 @@ func Test_Events_002(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func Test_Events_003(t *testing.T) {
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop()
+
+	tests := []struct {
+		topics []string
+		names  []string
+	}{
+		{[]string{"sensor.a"}, []string{"sensor.a"}},
+		{[]string{"sensor.*"}, []string{"sensor.a", "sensor.b"}},
+		{[]string{"sensor.#"}, []string{"sensor", "sensor.a", "sensor.b", "sensor.a.b"}},
+		{[]string{"*.a"}, []string{"sensor.a", "other.a"}},
+		{[]string{"#.b"}, []string{"sensor.b", "sensor.a.b"}},
+		{[]string{"sensor.*.b", "other.a"}, []string{"sensor.a.b", "other.a"}},
+	}
+	emit := []string{"sensor", "sensor.a", "sensor.b", "sensor.a.b", "other.a", "last"}
+
+	for _, test := range tests {
+		ch, all := e.Events.SubscribeTopic(test.topics...), e.Events.SubscribeTopic("last")
+		go func() {
+			for _, name := range emit {
+				e.Events.Emit(&event{name})
+			}
+		}()
+		var names []string
+		for evt := range ch {
+			names = append(names, evt.Name())
+			if len(names) == len(test.names) {
+				break
+			}
+		}
+		<-all
+		if fmt.Sprint(names) != fmt.Sprint(test.names) {
+			t.Error("Unexpected events for", test.topics, names, "...expected:", test.names)
+		}
+		e.Events.Unsubscribe(ch)
+		e.Events.Unsubscribe(all)
+	}
+}
+
+func Test_Events_004(t *testing.T) {
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop()
+
+	tests := []struct {
+		overflow graph.Overflow
+		names    []string
+		dropped  uint64
+	}{
+		{graph.OverflowDropNewest, []string{"test.0", "test.1"}, 3},
+		{graph.OverflowDropOldest, []string{"test.3", "test.4"}, 3},
+		{graph.OverflowDisconnect, []string{"test.0", "test.1"}, 1},
+	}
+
+	for _, test := range tests {
+		// Slow subscriber does not block the fast subscriber or emitter
+		slow := e.Events.SubscribeWith(graph.Subscription{
+			Topics:   []string{"test.*"},
+			Buffer:   2,
+			Overflow: test.overflow,
+		})
+		fast := e.Events.SubscribeTopic("test.*")
+		go func() {
+			for i := 0; i < 5; i++ {
+				e.Events.Emit(&event{fmt.Sprint("test.", i)})
+			}
+		}()
+		for i := 0; i < 5; i++ {
+			<-fast
+		}
+
+		// The slow subscriber may be dispatched by another shard, so
+		// wait for the states to be dropped
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if e.Events.Dropped(slow) == test.dropped {
+				break
+			}
+		}
+
+		var names []string
+		for len(names) < len(test.names) {
+			names = append(names, (<-slow).Name())
+		}
+		if fmt.Sprint(names) != fmt.Sprint(test.names) {
+			t.Error("Unexpected events for", test.overflow, names, "...expected:", test.names)
+		}
+		if dropped := e.Events.Dropped(slow); dropped != test.dropped {
+			t.Error("Unexpected dropped for", test.overflow, dropped, "...expected:", test.dropped)
+		}
+		if test.overflow == graph.OverflowDisconnect {
+			if _, ok := <-slow; ok {
+				t.Error("Expected channel to be closed on disconnect")
+			}
+		}
+		e.Events.Unsubscribe(fast)
+		e.Events.Unsubscribe(slow)
+	}
+}
+
+func Test_Events_005(t *testing.T) {
+	// Unsubscribe whilst the dispatcher is blocked does not deadlock
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop()
+
+	blocked := e.Events.SubscribeTopic("test.a")
+	go e.Events.Emit(&event{"test.a"})
+	time.Sleep(10 * time.Millisecond)
+	e.Events.Unsubscribe(blocked)
+
+	ch := e.Events.SubscribeTopic("test.b")
+	go e.Events.Emit(&event{"test.b"})
+	if evt := <-ch; evt.Name() != "test.b" {
+		t.Error("Unexpected event:", evt)
+	}
+	e.Events.Unsubscribe(ch)
+}
+
+func Test_Events_006(t *testing.T) {
+	// EmitContext respects deadlines and returns ErrClosed after shutdown
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Not yet dispatching, so deadline is exceeded
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := e.Events.EmitContext(ctx, nil); errors.Is(err, context.DeadlineExceeded) == false {
+		t.Error("Expected deadline exceeded, got:", err)
+	}
+
+	// Dispatching
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Events.EmitContext(context.Background(), nil); err != nil {
+		t.Error(err)
+	}
+
+	// Stopped, so events are closed
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := e.Events.EmitContext(context.Background(), nil); errors.Is(err, graph.ErrClosed) == false {
+		t.Error("Expected ErrClosed, got:", err)
+	}
+
+	// Started again, and then disposed
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Events.EmitContext(context.Background(), nil); err != nil {
+		t.Error(err)
+	}
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+	if err := e.Events.EmitContext(context.Background(), nil); errors.Is(err, graph.ErrClosed) == false {
+		t.Error("Expected ErrClosed, got:", err)
+	}
+	e.Events.Emit(nil)
+}
+
+func Test_Events_007(t *testing.T) {
+	// Handlers are called whilst running, and errors and panics are returned
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var n int
+	errFailed, errPanic := errors.New("failed"), errors.New("panicked")
+	e.Events.Handle(graph.Subscription{Topics: []string{"count"}, Concurrency: 4}, func(ctx context.Context, evt graph.State) error {
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		return nil
+	})
+	e.Events.Handle(graph.Subscription{Topics: []string{"fail"}}, func(ctx context.Context, evt graph.State) error {
+		return errFailed
+	})
+	e.Events.Handle(graph.Subscription{Topics: []string{"panic"}}, func(ctx context.Context, evt graph.State) error {
+		panic(errPanic)
+	})
+
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		e.Events.Emit(&event{"count"})
+	}
+	e.Events.Emit(&event{"fail"})
+	e.Events.Emit(&event{"panic"})
+
+	// Wait for handlers to be called
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		count := n
+		mu.Unlock()
+		if count == 100 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	err := g.Stop()
+	if errors.Is(err, errFailed) == false {
+		t.Error("Expected handler error, got:", err)
+	}
+	if errors.Is(err, errPanic) == false {
+		t.Error("Expected handler panic, got:", err)
+	}
+	mu.Lock()
+	if n != 100 {
+		t.Error("Expected 100 calls, got", n)
+	}
+	mu.Unlock()
+}
+
+func Test_Events_008(t *testing.T) {
+	// Handlers can be added whilst running and removed
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan string)
+	remove := e.Events.Handle(graph.Subscription{Topics: []string{"a"}}, func(ctx context.Context, evt graph.State) error {
+		select {
+		case ch <- evt.Name():
+		case <-ctx.Done():
+		}
+		return nil
+	})
+	e.Events.Emit(&event{"a"})
+	if name := <-ch; name != "a" {
+		t.Error("Unexpected event", name)
+	}
+
+	// Once removed, the handler is not called
+	remove()
+	e.Events.Emit(&event{"a"})
+	select {
+	case name := <-ch:
+		t.Error("Unexpected event", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_009(t *testing.T) {
+	// Requests are replied to by responders matching topics
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	errFailed := errors.New("failed")
+	e.Events.Respond("math.double", func(ctx context.Context, req graph.State) (graph.State, error) {
+		return &message{"math.result", req.Value().(int) * 2}, nil
+	})
+	e.Events.Respond("math.fail.*", func(ctx context.Context, req graph.State) (graph.State, error) {
+		return nil, errFailed
+	})
+	remove := e.Events.Respond("wait", func(ctx context.Context, req graph.State) (graph.State, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	// Concurrent requests are correlated with replies
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if reply, err := e.Events.Request(context.Background(), &message{"math.double", i}); err != nil {
+				t.Error(err)
+			} else if reply.Value() != i*2 {
+				t.Error("Unexpected reply", reply.Value(), "for", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Errors are returned to the requester
+	if _, err := e.Events.Request(context.Background(), &message{"math.fail.now", 0}); errors.Is(err, errFailed) == false {
+		t.Error("Expected error, got:", err)
+	}
+
+	// Requests without responders fail immediately
+	if _, err := e.Events.Request(context.Background(), &message{"math.triple", 0}); errors.Is(err, graph.ErrNoResponder) == false {
+		t.Error("Expected ErrNoResponder, got:", err)
+	}
+
+	// Requests time out
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := e.Events.Request(ctx, &event{"wait"}); errors.Is(err, context.DeadlineExceeded) == false {
+		t.Error("Expected deadline exceeded, got:", err)
+	}
+
+	// Removed responders no longer respond
+	remove()
+	if _, err := e.Events.Request(context.Background(), &event{"wait"}); errors.Is(err, graph.ErrNoResponder) == false {
+		t.Error("Expected ErrNoResponder, got:", err)
+	}
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_010(t *testing.T) {
+	// New subscribers receive retained states
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	e.Events.Retain("status.*")
+	e.Events.Emit(&message{"status.a", 1})
+	e.Events.Emit(&message{"status.b", 1})
+	e.Events.Emit(&message{"status.a", 2})
+	e.Events.Emit(&message{"other", 1})
+
+	// Wait for states to be dispatched
+	done := e.Events.SubscribeTopic("done")
+	e.Events.Emit(&event{"done"})
+	<-done
+	e.Events.Unsubscribe(done)
+
+	// Receive the most recent state for each retained name, then new states
+	ch := e.Events.SubscribeTopic("status.#", "other")
+	go e.Events.Emit(&message{"other", 2})
+	for _, expected := range []string{"status.a=2", "status.b=1", "other=2"} {
+		select {
+		case evt := <-ch:
+			if str := fmt.Sprint(evt.Name(), "=", evt.Value()); str != expected {
+				t.Error("Expected", expected, "got", str)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for", expected)
+		}
+	}
+	e.Events.Unsubscribe(ch)
+
+	// Subscribers which don't match don't receive retained states
+	ch = e.Events.SubscribeTopic("status.b")
+	if evt := <-ch; evt.Name() != "status.b" {
+		t.Error("Unexpected", evt.Name())
+	}
+	e.Events.Unsubscribe(ch)
+
+	// Cleared states are no longer received
+	e.Events.ClearRetained("status.a")
+	ch = e.Events.SubscribeTopic("status.#")
+	if evt := <-ch; evt.Name() != "status.b" {
+		t.Error("Unexpected", evt.Name())
+	}
+	e.Events.Unsubscribe(ch)
+	e.Events.ClearRetained()
+	ch = e.Events.SubscribeTopic("status.#")
+	select {
+	case evt := <-ch:
+		t.Error("Unexpected", evt.Name())
+	case <-time.After(50 * time.Millisecond):
+	}
+	e.Events.Unsubscribe(ch)
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_011(t *testing.T) {
+	// Interceptors are called in order, and can transform or drop states
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	errBad := errors.New("bad")
+	for _, suffix := range []string{".a", ".b"} {
+		suffix := suffix
+		e.Events.Intercept(func(ctx context.Context, s graph.State) (graph.State, error) {
+			return &event{s.Name() + suffix}, nil
+		})
+	}
+	remove := e.Events.Intercept(func(ctx context.Context, s graph.State) (graph.State, error) {
+		switch s.Name() {
+		case "drop.a.b":
+			return nil, nil
+		case "bad.a.b":
+			return nil, errBad
+		default:
+			return s, nil
+		}
+	})
+
+	ch := e.Events.SubscribeWith(graph.Subscription{Topics: []string{"*.a.b"}, Buffer: 10})
+	if err := e.Events.EmitContext(context.Background(), &event{"bad"}); errors.Is(err, errBad) == false {
+		t.Error("Expected error, got:", err)
+	}
+	e.Events.Emit(&event{"drop"})
+	e.Events.Emit(&event{"x"})
+	if evt := <-ch; evt.Name() != "x.a.b" {
+		t.Error("Unexpected", evt.Name())
+	}
+
+	// Removed interceptors are no longer called
+	remove()
+	e.Events.Emit(&event{"drop"})
+	if evt := <-ch; evt.Name() != "drop.a.b" {
+		t.Error("Unexpected", evt.Name())
+	}
+	e.Events.Unsubscribe(ch)
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_012(t *testing.T) {
+	// States are enriched with the time and source unit
+	s := new(S)
+	g := pkg.New(s).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	s.Events.Intercept(pkg.Enrich())
+	ch := s.Events.SubscribeTopic("hello")
+	now := time.Now()
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if evt, ok := (<-ch).(*graph.Envelope); ok == false {
+		t.Error("Expected envelope")
+	} else if evt.Source != s {
+		t.Error("Unexpected source", evt.Source)
+	} else if evt.Time.Before(now) || evt.Time.After(time.Now()) {
+		t.Error("Unexpected time", evt.Time)
+	} else if _, ok := evt.Unwrap().(*event); ok == false {
+		t.Error("Unexpected state", evt.Unwrap())
+	}
+	s.Events.Unsubscribe(ch)
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_013(t *testing.T) {
+	// Typed subscribers only receive values of their type
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, unsubscribe := graph.SubscribeTyped[*message](e.Events)
+	numbers, unsubscribeNumbers := graph.SubscribeTyped[int](e.Events)
+	defer unsubscribeNumbers()
+	go func() {
+		graph.EmitTyped(e.Events, 42)
+		graph.EmitTyped(e.Events, &message{"a", 1})
+		e.Events.Emit(&message{graph.TypedTopic[int](), "not an int"})
+		graph.EmitTyped(e.Events, 43)
+	}()
+
+	if m := <-messages; m.name != "a" {
+		t.Error("Unexpected message", m)
+	}
+	for _, expected := range []int{42, 43} {
+		if n := <-numbers; n != expected {
+			t.Error("Expected", expected, "got", n)
+		}
+	}
+
+	// Channel is closed when unsubscribed
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-messages; ok {
+		t.Error("Expected channel to be closed")
+	}
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_014(t *testing.T) {
+	// States with the same priority from each publisher are received in
+	// the order emitted
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	publishers, n := 4, 100
+	ch := e.Events.SubscribeTopic("fifo")
+	for i := 0; i < publishers; i++ {
+		go func(i int) {
+			for j := 0; j < n; j++ {
+				level := graph.PriorityNormal
+				if j%2 == 0 {
+					level = graph.PriorityLow
+				}
+				e.Events.Emit(&priority{event{"fifo"}, level})
+				e.Events.Emit(&message{"fifo", [2]int{i, j}})
+			}
+		}(i)
+	}
+
+	next := make([]int, publishers)
+	for received := 0; received < publishers*n; {
+		evt := <-ch
+		if v, ok := evt.Value().([2]int); ok {
+			if v[1] != next[v[0]] {
+				t.Fatal("Publisher", v[0], "expected", next[v[0]], "got", v[1])
+			}
+			next[v[0]]++
+			received++
+		}
+	}
+	e.Events.Unsubscribe(ch)
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_015(t *testing.T) {
+	// States with a higher priority overtake waiting states
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Block the dispatcher, then emit states which wait to be dispatched.
+	// States which have already been batched are not overtaken
+	n := 500
+	ch := e.Events.SubscribeTopic("block", "low", "normal", "high")
+	go e.Events.Emit(&event{"block"})
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < n; i++ {
+		e.Events.Emit(&priority{event{"low"}, graph.PriorityLow})
+	}
+	time.Sleep(10 * time.Millisecond)
+	e.Events.Emit(&event{"normal"})
+	e.Events.Emit(&priority{event{"high"}, graph.PriorityHigh})
+
+	// Receive states in priority order. Whilst the dispatcher is blocked,
+	// up to two batches of 64 low states can already have been taken,
+	// and the remaining low states are overtaken by high and normal
+	names := make([]string, 0, n+3)
+	for len(names) < n+3 {
+		names = append(names, (<-ch).Name())
+	}
+	if names[0] != "block" {
+		t.Error("Expected block first, got", names[0])
+	}
+	taken := 0
+	for _, name := range names[1:] {
+		if name != "low" {
+			break
+		}
+		taken++
+	}
+	if taken > 2*64 {
+		t.Error("Expected high to overtake waiting low states, after", taken)
+	} else if names[taken+1] != "high" || names[taken+2] != "normal" {
+		t.Error("Expected high then normal, got", names[taken+1:taken+3])
+	}
+	e.Events.Unsubscribe(ch)
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_016(t *testing.T) {
+	// Statistics count states for each topic and subscriber, and are
+	// emitted periodically when enabled with a flag
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	flags := tool.NewFlagset(t.Name())
+	g.Define(flags)
+	if err := flags.Parse([]string{"-events.stats", "10ms"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.New(flags); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The subscriber receives the first state, and the buffer is full
+	// for the remaining states
+	ch := e.Events.SubscribeWith(graph.Subscription{
+		Topics:   []string{"a"},
+		Buffer:   1,
+		Overflow: graph.OverflowDropNewest,
+	})
+	for i := 0; i < 3; i++ {
+		e.Events.Emit(&event{"a"})
+	}
+	stats := e.Events.Stats()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); stats = e.Events.Stats() {
+		if c := stats.Topics["a"]; c.Delivered+c.Dropped == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if c := stats.Topics["a"]; c.Emitted != 3 || c.Delivered != 1 || c.Dropped != 2 {
+		t.Error("Unexpected topic stats", c)
+	}
+	if len(stats.Subscribers) != 1 {
+		t.Error("Unexpected subscribers", stats.Subscribers)
+	} else if s := stats.Subscribers[0]; s.Lag != 1 || s.Buffer != 1 || s.Delivered != 1 || s.Dropped != 2 {
+		t.Error("Unexpected subscriber stats", s)
+	}
+	if stats.Latency.Count > 3 || len(stats.Latency.Counts) != len(stats.Latency.Bounds)+1 {
+		t.Error("Unexpected latency", stats.Latency)
+	}
+	e.Events.Unsubscribe(ch)
+
+	// Statistics are emitted periodically
+	ch = e.Events.SubscribeTopic(graph.EventsStats)
+	if evt := <-ch; evt.Name() != graph.EventsStats {
+		t.Error("Unexpected state", evt)
+	} else if stats, ok := evt.Value().(graph.EventStats); ok == false {
+		t.Error("Unexpected value", evt.Value())
+	} else if stats.Topics["a"].Emitted != 3 {
+		t.Error("Unexpected stats", evt)
+	}
+	e.Events.Unsubscribe(ch)
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_017(t *testing.T) {
+	// States without a subscriber, and states which a handler fails to
+	// handle after retries, are dead letters
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	errFailed := errors.New("failed")
+	var calls int32
+	e.Events.Handle(graph.Subscription{
+		Topics:  []string{"fail"},
+		Retries: 2,
+		Backoff: time.Millisecond,
+	}, func(context.Context, graph.State) error {
+		atomic.AddInt32(&calls, 1)
+		return errFailed
+	})
+	ch := e.Events.SubscribeTopic(graph.DeadLetter)
+	go func() {
+		e.Events.Emit(&event{"nobody"})
+		e.Events.Emit(&event{"fail"})
+	}()
+
+	for _, expected := range []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"nobody", graph.ErrNoSubscriber, 0},
+		{"fail", errFailed, 3},
+	} {
+		evt := <-ch
+		if dead, ok := evt.(*graph.Undelivered); ok == false {
+			t.Error("Unexpected state", evt)
+		} else if dead.State.Name() != expected.name || dead.Attempts != expected.attempts {
+			t.Error("Unexpected dead letter", dead)
+		} else if errors.Is(dead, expected.err) == false {
+			t.Error("Unexpected reason", dead.Err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Error("Expected three calls, got", n)
+	}
+	e.Events.Unsubscribe(ch)
+
+	// The handler error is returned from Run
+	if err := g.Stop(); errors.Is(err, errFailed) == false {
+		t.Error("Unexpected error", err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_018(t *testing.T) {
+	// States from one publisher with mixed priorities are received in
+	// order for each priority, but a waiting state with a higher priority
+	// overtakes a state with a lower priority emitted before it
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Block the dispatcher, then emit states which wait to be dispatched
+	n := 500
+	ch := e.Events.SubscribeTopic("block", "low.*", "normal.*")
+	go e.Events.Emit(&event{"block"})
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < n; i++ {
+		e.Events.Emit(&priority{event{fmt.Sprint("low.", i)}, graph.PriorityLow})
+		e.Events.Emit(&priority{event{fmt.Sprint("normal.", i)}, graph.PriorityNormal})
+	}
+
+	// Receive states in order for each priority
+	next, last := make(map[string]int), make(map[string]int)
+	if evt := <-ch; evt.Name() != "block" {
+		t.Fatal("Expected block first, got", evt.Name())
+	}
+	for i := 0; i < 2*n; i++ {
+		name, value, _ := strings.Cut((<-ch).Name(), ".")
+		if seq, err := strconv.Atoi(value); err != nil {
+			t.Fatal(err)
+		} else if seq != next[name] {
+			t.Fatal("Unexpected order", name, seq)
+		}
+		next[name], last[name] = next[name]+1, i
+	}
+	if last["normal"] > last["low"] {
+		t.Error("Expected normal states to overtake low states")
+	}
+	e.Events.Unsubscribe(ch)
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_019(t *testing.T) {
+	// States which have been accepted are dispatched when stopping,
+	// to subscribers which have room in their buffer
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	g.SetDrainTimeout(0)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Block the dispatcher with a subscriber which does not receive,
+	// then emit states which wait to be dispatched
+	n := 500
+	block := e.Events.SubscribeTopic("block")
+	ch := e.Events.SubscribeWith(graph.Subscription{Topics: []string{"a"}, Buffer: n})
+	e.Events.Emit(&event{"block"})
+	for i := 0; i < n; i++ {
+		if err := e.Events.EmitContext(context.Background(), &event{"a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+
+	// Every state is in the buffer
+	if len(ch) != n {
+		t.Error("Expected", n, "states, got", len(ch))
+	}
+	if stats := e.Events.Stats(); stats.Topics["a"].Delivered != uint64(n) {
+		t.Error("Unexpected stats", stats.Topics["a"])
+	}
+	e.Events.Unsubscribe(block)
+	e.Events.Unsubscribe(ch)
+
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_020(t *testing.T) {
+	// A handler is called for a later state by another goroutine whilst
+	// a retry is waiting
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var failed int32
+	calls := make(chan string, 3)
+	e.Events.Handle(graph.Subscription{
+		Topics:      []string{"first", "second"},
+		Concurrency: 2,
+		Retries:     1,
+		Backoff:     time.Second,
+	}, func(ctx context.Context, evt graph.State) error {
+		calls <- evt.Name()
+		if evt.Name() == "first" && atomic.AddInt32(&failed, 1) == 1 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	go func() {
+		e.Events.Emit(&event{"first"})
+		e.Events.Emit(&event{"second"})
+	}()
+
+	// The second state is handled before the retry, which is after the
+	// backoff. The goroutines may call the handler in either order
+	start := time.Now()
+	received := map[string]bool{<-calls: true, <-calls: true}
+	if received["first"] == false || received["second"] == false {
+		t.Error("Unexpected calls", received)
+	}
+	if since := time.Since(start); since >= time.Second {
+		t.Error("Expected second state whilst retry is waiting, after", since)
+	}
+	if name := <-calls; name != "first" {
+		t.Error("Expected retry, got", name)
+	}
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_021(t *testing.T) {
+	// No more than the concurrency of a handler are calling it whilst
+	// retrying
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	n, concurrency, retries := 10, 2, 3
+	var calls, running, max int32
+	e.Events.Handle(graph.Subscription{
+		Topics:      []string{"fail"},
+		Concurrency: concurrency,
+		Retries:     retries,
+		Backoff:     time.Millisecond,
+	}, func(context.Context, graph.State) error {
+		defer atomic.AddInt32(&running, -1)
+		now := atomic.AddInt32(&running, 1)
+		for m := atomic.LoadInt32(&max); now > m; m = atomic.LoadInt32(&max) {
+			if atomic.CompareAndSwapInt32(&max, m, now) {
+				break
+			}
+		}
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond)
+		return errors.New("failed")
+	})
+	ch := e.Events.SubscribeWith(graph.Subscription{Topics: []string{graph.DeadLetter}, Buffer: n})
+	go func() {
+		for i := 0; i < n; i++ {
+			e.Events.Emit(&event{"fail"})
+		}
+	}()
+	for i := 0; i < n; i++ {
+		<-ch
+	}
+	if c := atomic.LoadInt32(&calls); c != int32(n*(retries+1)) {
+		t.Error("Expected", n*(retries+1), "calls, got", c)
+	}
+	if m := atomic.LoadInt32(&max); m > int32(concurrency) {
+		t.Error("Expected at most", concurrency, "concurrent calls, got", m)
+	}
+	e.Events.Unsubscribe(ch)
+
+	if err := g.Stop(); err == nil {
+		t.Error("Expected handler errors")
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_022(t *testing.T) {
+	// Internal states are not retained when all topics are retained
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first subscriber receives the retained state with a replay
+	e.Events.Retain("#")
+	probe := e.Events.SubscribeTopic("a")
+	e.Events.Emit(&event{"a"})
+	<-probe
+	e.Events.Unsubscribe(probe)
+	topics := []string{"a", "end", "<replay>"}
+	first := e.Events.SubscribeTopic(topics...)
+	if evt := <-first; evt.Name() != "a" {
+		t.Error("Unexpected state", evt.Name())
+	}
+
+	// The second subscriber receives the retained state, and not the replay
+	e.Events.Unsubscribe(first)
+	second := e.Events.SubscribeTopic(topics...)
+	e.Events.Emit(&event{"end"})
+	for _, expected := range []string{"a", "end"} {
+		if evt := <-second; evt.Name() != expected {
+			t.Error("Expected", expected, "got", evt.Name())
+		}
+	}
+	e.Events.Unsubscribe(second)
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_023(t *testing.T) {
+	// States are counted under graph.OtherTopics once the maximum number
+	// of state names are counted
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 2000
+	for i := 0; i < n; i++ {
+		e.Events.Emit(&event{fmt.Sprint("id.", i)})
+	}
+	emitted := func(stats graph.EventStats) uint64 {
+		var result uint64
+		for name, c := range stats.Topics {
+			if strings.HasPrefix(name, "id.") || name == graph.OtherTopics {
+				result += c.Emitted
+			}
+		}
+		return result
+	}
+	stats := e.Events.Stats()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline) && emitted(stats) < uint64(n); stats = e.Events.Stats() {
+		time.Sleep(time.Millisecond)
+	}
+	if c := emitted(stats); c < uint64(n) {
+		t.Error("Expected", n, "states counted, got", c)
+	}
+	if len(stats.Topics) > 1024 {
+		t.Error("Expected at most 1024 topics, got", len(stats.Topics))
+	}
+	if c := stats.Topics[graph.OtherTopics]; c.Emitted == 0 {
+		t.Error("Expected states counted as other topics")
+	}
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Events_024(t *testing.T) {
+	// Handler errors are logged as they occur by the logger injected
+	// into the events unit
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		t.Fatal(err)
+	}
+	logger, ok := g.Logger().(*recorder)
+	if ok == false {
+		t.Fatal("Expected recorder, got", g.Logger())
+	}
+	errFailed := errors.New("failed")
+	e.Events.Handle(graph.Subscription{Topics: []string{"fail"}}, func(context.Context, graph.State) error {
+		return errFailed
+	})
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	e.Events.Emit(&event{"fail"})
+	for i := 0; i < 100 && len(logger.Errors()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	expected := "graph.events Handler failed state=fail attempts=1 err=failed"
+	if errs := logger.Errors(); len(errs) != 1 || errs[0] != expected {
+		t.Errorf("Unexpected errors: %q", errs)
+	}
+
+	// The handler error is also returned from Run
+	if err := g.Stop(); errors.Is(err, errFailed) == false {
+		t.Error("Unexpected error", err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// BENCHMARKS
+
+// benchmark emits states to a number of subscribers, which receive on
+// buffered channels, from parallel goroutines
+func benchmark(b *testing.B, subscribers int, fn func(graph.Events)) {
+	e := new(T)
+	g := pkg.New(e).(*pkg.Graph)
+	if err := g.New(pkg.NullState()); err != nil {
+		b.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+
+	// Receive states until unsubscribed
+	var wg sync.WaitGroup
+	var chs []<-chan graph.State
+	for i := 0; i < subscribers; i++ {
+		ch := e.Events.SubscribeWith(graph.Subscription{Buffer: 1000})
+		chs = append(chs, ch)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range ch {
+			}
+		}()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			fn(e.Events)
+		}
+	})
+	b.StopTimer()
+
+	for _, ch := range chs {
+		e.Events.Unsubscribe(ch)
+	}
+	wg.Wait()
+	if err := g.Stop(); err != nil {
+		b.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		b.Error(err)
+	}
+}
+
+func Benchmark_Events_001(b *testing.B) {
+	// Emit NullState to one subscriber
+	benchmark(b, 1, func(events graph.Events) {
+		events.Emit(nil)
+	})
+}
+
+func Benchmark_Events_002(b *testing.B) {
+	// Emit NullState to ten subscribers
+	benchmark(b, 10, func(events graph.Events) {
+		events.Emit(nil)
+	})
+}
+
+func Benchmark_Events_003(b *testing.B) {
+	// Emit states to a hundred subscribers
+	evt := &event{"sensor.reading"}
+	benchmark(b, 100, func(events graph.Events) {
+		events.Emit(evt)
+	})
+}
@@ -1,11 +1,13 @@
 package graph
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/djthorpe/graph"
 	"github.com/hashicorp/go-multierror"
@@ -19,14 +21,39 @@ type Graph struct {
 
 	objs  []reflect.Value
 	units map[reflect.Type]reflect.Value
+	drain time.Duration
+
+	// Runtime state is guarded separately, as Run holds
+	// the lock until all units have completed
+	rt                 sync.Mutex
+	running, scheduled bool
+	ready, starting    bool
+	queue              *queue
+	cancel             context.CancelFunc
+	child              *RunContext
+	status             map[interface{}]*Status
+	statuses           []*Status
+
+	// Pause and Resume are serialised, so that a unit is not
+	// paused or resumed twice
+	pausing sync.Mutex
 }
 
 /////////////////////////////////////////////////////////////////////
 // GLOBALS
 
+const (
+	// DefaultDrainTimeout is the deadline for all units to drain
+	// before Run methods are cancelled
+	DefaultDrainTimeout = 5 * time.Second
+)
+
 var (
 	errCircularReference = errors.New("Circular Reference")
 	errUnassignableField = errors.New("Unassignable (private) Field")
+	errUnknownUnit       = errors.New("Unknown Unit")
+	errRunning           = errors.New("Graph is running")
+	errNotRunning        = errors.New("Graph has not been run")
 )
 
 /////////////////////////////////////////////////////////////////////
@@ -49,6 +76,7 @@ func New(objs ...interface{}) graph.Graph {
 func (g *Graph) new(objs []interface{}) *Graph {
 	g.objs = make([]reflect.Value, len(objs))
 	g.units = make(map[reflect.Type]reflect.Value, len(objs)*4) // Arbitary assumption on number of units per object
+	g.drain = DefaultDrainTimeout
 
 	// Assign objects
 	for i := range objs {
@@ -62,6 +90,9 @@ func (g *Graph) new(objs []interface{}) *Graph {
 		}
 	}
 
+	// Set all objects and units to created state
+	g.newStatus()
+
 	return g
 }
 
@@ -121,6 +152,15 @@ func (g *Graph) Dispose() error {
 	return nil
 }
 
+// SetDrainTimeout sets the deadline for the drain phase, which is
+// invoked before Run methods are cancelled. A zero or negative value
+// skips draining altogether.
+func (g *Graph) SetDrainTimeout(d time.Duration) {
+	g.RWMutex.Lock()
+	defer g.RWMutex.Unlock()
+	g.drain = d
+}
+
 /////////////////////////////////////////////////////////////////////
 // LOGGING
 
@@ -136,6 +176,41 @@ func (g *Graph) Logger() graph.Logger {
 	}
 }
 
+/////////////////////////////////////////////////////////////////////
+// EVENTS
+
+// Events returns any registered events unit or nil
+// it not registered
+func (g *Graph) Events() graph.Events {
+	if t := graph.UnitTypeForInterface(eventsType); t == nil {
+		return nil
+	} else if v, exists := g.units[t]; exists == false {
+		return nil
+	} else {
+		return v.Interface().(graph.Events)
+	}
+}
+
+// emit queues a lifecycle event when the graph is running and
+// there is an events unit in the graph
+func (g *Graph) emit(name string, value interface{}) {
+	if g == nil {
+		return
+	}
+
+	g.rt.Lock()
+	defer g.rt.Unlock()
+	g.push(name, value)
+}
+
+// push queues a lifecycle event, and should be called whilst
+// holding the runtime lock
+func (g *Graph) push(name string, value interface{}) {
+	if g.running && g.queue != nil {
+		g.queue.push(&lifecycle{name, value})
+	}
+}
+
 /////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
@@ -182,8 +257,12 @@ func (g *Graph) graph(unit reflect.Value) error {
 			g.graph(g.units[t])
 		}
 
-		// Set field to unit
-		unit.Elem().Field(i).Set(g.units[t])
+		// Set field to unit, or a logger named for the unit
+		if equalsType(f.Type, logType) {
+			unit.Elem().Field(i).Set(namedLogger(g.units[t], unit.Type()))
+		} else {
+			unit.Elem().Field(i).Set(g.units[t])
+		}
 
 		// Return success
 		return nil
@@ -194,12 +273,18 @@ func (g *Graph) graph(unit reflect.Value) error {
 func (g *Graph) do(fn string, unit reflect.Value, args []reflect.Value, seen map[reflect.Type]bool, obj bool) error {
 	var result error
 
-	// Call Dispose leaf-last, continue on error
+	// Call Drain and Dispose leaf-last, continue on error
 	switch fn {
-	case "Dispose":
+	case "Drain":
 		if err := call(fn, unit, args); err != nil {
 			result = multierror.Append(result, err)
 		}
+	case "Dispose":
+		err := call(fn, unit, args)
+		if err != nil {
+			result = multierror.Append(result, err)
+		}
+		g.setState(unit, StateDisposed, err)
 	}
 
 	// Descend into struct
@@ -222,9 +307,17 @@ func (g *Graph) do(fn string, unit reflect.Value, args []reflect.Value, seen map
 
 	// Call Define, New and Run leaf-first
 	switch fn {
-	case "Define", "New":
+	case "Define":
+		if err := call(fn, unit, args); err != nil {
+			result = multierror.Append(result, err)
+		}
+		g.setState(unit, StateDefined, nil)
+	case "New":
 		if err := call(fn, unit, args); err != nil {
 			result = multierror.Append(result, err)
+			g.setState(unit, StateFailed, err)
+		} else {
+			g.setState(unit, StateInitialized, nil)
 		}
 	case "Run":
 		args[0].Interface().(*RunContext).Run(unit, obj)
@@ -237,6 +330,32 @@ func (g *Graph) do(fn string, unit reflect.Value, args []reflect.Value, seen map
 	return result
 }
 
+// order returns objects and units with leaf units first, in the
+// same order as Define and New are called
+func (g *Graph) order() []reflect.Value {
+	result := make([]reflect.Value, 0, len(g.objs)+len(g.units))
+	seen := make(map[reflect.Type]bool, len(g.units))
+
+	var walk func(reflect.Value)
+	walk = func(unit reflect.Value) {
+		forEachField(unit, false, func(f reflect.StructField, i int) error {
+			if t := g.unitTypeForField(f); t == nil || equalsType(t, unit.Type()) {
+				return nil
+			} else if _, exists := seen[t]; exists == false {
+				walk(g.units[t])
+			}
+			return nil
+		})
+		seen[unit.Type()] = true
+		result = append(result, unit)
+	}
+	for _, obj := range g.objs {
+		walk(obj)
+	}
+
+	return result
+}
+
 // Returns type for struct field or nil if not a unit type.
 // Will translate any mapped interfaces to concrete types.
 func (g *Graph) unitTypeForField(f reflect.StructField) reflect.Type {
@@ -3,7 +3,9 @@ package graph_test
 import (
 	"context"
 	"errors"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -162,6 +164,83 @@ func (this *D) Run(ctx context.Context) error {
 	return ctx.Err()
 }
 
+type H struct {
+	graph.Unit
+	*state
+}
+
+type I struct {
+	graph.Unit
+	*H
+}
+
+type J struct {
+	graph.Unit
+}
+
+type K struct {
+	graph.Unit
+	graph.Events
+	*I
+}
+
+func (this *H) New(s *state) error {
+	this.state = s
+	return nil
+}
+
+func (this *H) Run(ctx context.Context) error {
+	<-ctx.Done()
+	this.state.Add("h")
+	return nil
+}
+
+func (this *H) Drain(context.Context) error {
+	this.state.Add("H")
+	return nil
+}
+
+func (this *I) Run(ctx context.Context) error {
+	<-ctx.Done()
+	this.state.Add("i")
+	return nil
+}
+
+func (this *I) Drain(context.Context) error {
+	this.state.Add("I")
+	return nil
+}
+
+func (this *H) Pause(context.Context) error {
+	this.state.Add("P")
+	return nil
+}
+
+func (this *H) Resume(context.Context) error {
+	this.state.Add("R")
+	return nil
+}
+
+func (this *I) Pause(context.Context) error {
+	this.state.Add("p")
+	return nil
+}
+
+func (this *I) Resume(context.Context) error {
+	this.state.Add("r")
+	return nil
+}
+
+func (this *K) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (this *J) Drain(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
 /////////////////////////////////////////////////////////////////////
 // TESTS
 
@@ -410,3 +489,405 @@ func Test_Graph_012(t *testing.T) {
 		t.Error("Unexpected New call order:", state.Value(), "...expected:", "ABDDxxxB")
 	}
 }
+
+func Test_Graph_013(t *testing.T) {
+	// Drain is called leaf-last whilst dependencies are still running
+	g, state := pkg.New(new(I)), NewState(t)
+	if err := g.New(state); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := g.Run(ctx); err != nil && err != context.DeadlineExceeded {
+		t.Error(err)
+	}
+	// Run methods end after drain, in any order
+	if state.Equals("IHih") == false && state.Equals("IHhi") == false {
+		t.Error("Unexpected drain order:", state.Value(), "...expected:", "IHxx")
+	}
+}
+
+func Test_Graph_014(t *testing.T) {
+	// Drain is bounded by the drain timeout
+	g, state := pkg.New(new(J)), NewState(t)
+	if err := g.New(state); err != nil {
+		t.Error(err)
+	}
+	g.(*pkg.Graph).SetDrainTimeout(100 * time.Millisecond)
+
+	now := time.Now()
+	if err := g.Run(context.Background()); errors.Is(err, context.DeadlineExceeded) == false {
+		t.Error("Expected deadline exceeded, got:", err)
+	}
+	if time.Since(now) >= time.Second {
+		t.Error("Drain did not end at deadline")
+	}
+}
+
+func Test_Graph_015(t *testing.T) {
+	// Pause is called leaf-last and Resume leaf-first
+	k, state := new(K), NewState(t)
+	g := pkg.New(k).(*pkg.Graph)
+	if err := g.New(state); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := g.Pause(ctx); err == nil {
+		t.Error("Expected error pausing when not running")
+	}
+	if err := g.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.Pause(ctx); err != nil {
+		t.Error(err)
+	}
+	if g.IsPaused(k.I) == false || g.IsPaused(k.H) == false {
+		t.Error("Expected units to be paused")
+	}
+	if err := g.Pause(ctx, k.I); err != nil {
+		t.Error(err)
+	}
+	if err := g.Resume(ctx); err != nil {
+		t.Error(err)
+	}
+	if g.IsPaused(k.I) || g.IsPaused(k.H) {
+		t.Error("Expected units to be resumed")
+	}
+	if err := g.Pause(ctx, new(H)); err == nil {
+		t.Error("Expected error pausing unit not in graph")
+	}
+
+	cancel()
+	if err := g.Stop(); err != nil && errors.Is(err, context.Canceled) == false {
+		t.Error(err)
+	}
+	if state.Equals("pPRrIHhi") == false && state.Equals("pPRrIHih") == false {
+		t.Error("Unexpected pause order:", state.Value(), "...expected:", "pPRrIHxx")
+	}
+}
+
+func Test_Graph_016(t *testing.T) {
+	// Pause and resume emit events
+	k, state := new(K), NewState(t)
+	g := pkg.New(k).(*pkg.Graph)
+	if err := g.New(state); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error)
+	go func() {
+		errs <- g.Run(ctx)
+	}()
+
+	// Wait for events to be dispatched before pausing
+	ch := k.Events.Subscribe()
+	go k.Events.Emit(nil)
+	for evt := <-ch; evt.Name() != pkg.NullState().Name(); evt = <-ch {
+	}
+
+	go func() {
+		if err := g.Pause(ctx, k.I); err != nil {
+			t.Error(err)
+		}
+		if err := g.Resume(ctx, k.I); err != nil {
+			t.Error(err)
+		}
+	}()
+	for _, name := range []string{graph.UnitPaused, graph.UnitResumed} {
+		evt := <-ch
+		for evt.Name() != graph.UnitPaused && evt.Name() != graph.UnitResumed {
+			evt = <-ch
+		}
+		if evt.Name() != name {
+			t.Error("Unexpected event", evt, "...expected:", name)
+		} else if evt.Value() != k.I {
+			t.Error("Unexpected event value", evt.Value())
+		}
+	}
+	k.Events.Unsubscribe(ch)
+
+	cancel()
+	<-errs
+}
+
+func Test_Graph_017(t *testing.T) {
+	// Status follows the lifecycle of each unit
+	i, state := new(I), NewState(t)
+	g := pkg.New(i).(*pkg.Graph)
+	if status := g.StatusOf(i); status == nil || status.State != pkg.StateCreated {
+		t.Error("Expected created state:", status)
+	}
+	if status := g.StatusOf(new(I)); status != nil {
+		t.Error("Expected nil status for unit not in graph")
+	}
+
+	g.Define(state)
+	if err := g.New(state); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range g.Status() {
+		if status.State != pkg.StateInitialized {
+			t.Error("Expected initialized state:", status)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		errs <- g.Run(ctx)
+	}()
+	for g.StatusOf(i.H).State != pkg.StateRunning {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-errs
+
+	if status := g.StatusOf(i); status.State != pkg.StateStopped {
+		t.Error("Expected stopped state:", status)
+	} else if status.Times[pkg.StateRunning].IsZero() {
+		t.Error("Expected running timestamp:", status)
+	}
+
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+	if status := g.Status(); len(status) != 2 {
+		t.Error("Unexpected status:", status)
+	} else if status[0].Unit != i.H || status[1].Unit != i {
+		t.Error("Expected leaf units first:", status)
+	}
+	for _, status := range g.Status() {
+		if status.State != pkg.StateDisposed {
+			t.Error("Expected disposed state:", status)
+		}
+	}
+}
+
+func Test_Graph_018(t *testing.T) {
+	// Status records errors from Run
+	c, state := new(C), NewState(t)
+	g := pkg.New(c).(*pkg.Graph)
+	if err := g.New(state); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Run(context.Background()); err == nil {
+		t.Error("Expected error from Run")
+	}
+	if status := g.StatusOf(c); status.State != pkg.StateFailed {
+		t.Error("Expected failed state:", status)
+	} else if status.Err == nil || status.Err.Error() != "Error from C" {
+		t.Error("Unexpected error:", status.Err)
+	}
+}
+
+func Test_Graph_019(t *testing.T) {
+	// Lifecycle events are emitted whilst running
+	k, state := new(K), NewState(t)
+	g := pkg.New(k).(*pkg.Graph)
+	if err := g.New(state); err != nil {
+		t.Fatal(err)
+	}
+
+	// Subscribe before running, so that no lifecycle events are missed
+	ch := k.Events.Subscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error)
+	go func() {
+		errs <- g.Run(ctx)
+	}()
+
+	// Wait for graph to be ready, recording started units
+	started := make(map[interface{}]bool)
+	for evt := range ch {
+		if evt.Name() == graph.UnitStarted {
+			started[evt.Value()] = true
+		}
+		if evt.Name() == graph.GraphReady {
+			if evt.Value() != g {
+				t.Error("Unexpected GraphReady value:", evt.Value())
+			}
+			break
+		}
+	}
+	for _, status := range g.Status() {
+		if status.State != pkg.StateRunning {
+			t.Error("Expected all units running when ready:", status)
+		}
+	}
+
+	// Wait for the graph to stop, and expect stopping to be emitted
+	cancel()
+	for evt := range ch {
+		if evt.Name() == graph.GraphStopping {
+			break
+		}
+	}
+	k.Events.Unsubscribe(ch)
+	<-errs
+}
+
+func Test_Graph_020(t *testing.T) {
+	// Start and Stop can be called repeatedly without New
+	i, state := new(I), NewState(t)
+	g := pkg.New(i).(*pkg.Graph)
+	if err := g.Stop(); err == nil {
+		t.Error("Expected error stopping graph which has not been run")
+	}
+	if err := g.New(state); err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < 3; n++ {
+		if err := g.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err := g.Start(context.Background()); err == nil {
+			t.Error("Expected error starting graph which is running")
+		}
+		if err := g.Stop(); err != nil {
+			t.Error(err)
+		}
+		if status := g.StatusOf(i); status.State != pkg.StateStopped {
+			t.Error("Expected stopped state:", status)
+		}
+	}
+
+	// Drain and Run return are called on each stop
+	if state.Equals("IHhiIHhiIHhi") == false {
+		v := state.Value().(string)
+		if len(v) != 12 || v[0:2] != "IH" || v[4:6] != "IH" || v[8:10] != "IH" {
+			t.Error("Unexpected call order:", v, "...expected:", "IHxxIHxxIHxx")
+		}
+	}
+}
+
+func Test_Graph_021(t *testing.T) {
+	// Stop ends a graph which is run with Run
+	k, state := new(K), NewState(t)
+	g := pkg.New(k).(*pkg.Graph)
+	if err := g.New(state); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error)
+	go func() {
+		errs <- g.Run(context.Background())
+	}()
+	for status := g.StatusOf(k); status.State != pkg.StateRunning; status = g.StatusOf(k) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+
+	// Run again, and emit an event to check the events unit is running
+	go func() {
+		errs <- g.Run(context.Background())
+	}()
+	for status := g.StatusOf(k); status.State != pkg.StateRunning; status = g.StatusOf(k) {
+		time.Sleep(time.Millisecond)
+	}
+	ch := k.Events.Subscribe()
+	go k.Events.Emit(nil)
+	for evt := <-ch; evt.Name() != pkg.NullState().Name(); evt = <-ch {
+	}
+	k.Events.Unsubscribe(ch)
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+	if err := g.Dispose(); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_Graph_022(t *testing.T) {
+	// Concurrent calls to Pause and Resume call each unit once
+	k, state := new(K), NewState(t)
+	g := pkg.New(k).(*pkg.Graph)
+	if err := g.New(state); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fn := range []func(context.Context, ...interface{}) error{g.Pause, g.Resume} {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := fn(context.Background(), k.I); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	if state.Equals("pr") == false {
+		t.Error("Unexpected pause and resume calls:", state.Value(), "...expected: pr")
+	}
+
+	if err := g.Stop(); err != nil {
+		t.Error(err)
+	}
+	if err := g.Resume(context.Background()); err == nil {
+		t.Error("Expected error resuming when not running")
+	}
+}
+
+func Test_Graph_023(t *testing.T) {
+	// Concurrent calls to Start run the graph once, and Stop returns an
+	// error once the graph has stopped
+	k, state := new(K), NewState(t)
+	g := pkg.New(k).(*pkg.Graph)
+	if err := g.New(state); err != nil {
+		t.Fatal(err)
+	}
+
+	goroutines := runtime.NumGoroutine()
+	for cycle := 0; cycle < 3; cycle++ {
+		var wg sync.WaitGroup
+		var started int32
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := g.Start(context.Background()); err == nil {
+					atomic.AddInt32(&started, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		if started != 1 {
+			t.Error("Unexpected number of starts:", started)
+		}
+		if err := g.Stop(); err != nil {
+			t.Error(err)
+		}
+		if err := g.Stop(); err == nil {
+			t.Error("Expected error stopping when not running")
+		}
+	}
+
+	// Wait for goroutines to end
+	for i := 0; i < 100 && runtime.NumGoroutine() > goroutines; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Error("Unexpected goroutines:", n, "...expected:", goroutines)
+	}
+}
@@ -0,0 +1,165 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// handler calls a function for each event received by a subscription,
+// from one or more goroutines
+type handler struct {
+	ch          <-chan graph.State
+	fn          graph.Handler
+	concurrency int
+	retries     int
+	backoff     time.Duration
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// defaultBackoff is the delay before retrying a handler when retries
+// are set without a backoff, and maxBackoff is the longest delay the
+// backoff is doubled to
+const (
+	defaultBackoff = 100 * time.Millisecond
+	maxBackoff     = time.Minute
+)
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+func (p *events) Handle(subscription graph.Subscription, fn graph.Handler) func() {
+	h := &handler{
+		ch:          p.SubscribeWith(subscription),
+		fn:          fn,
+		concurrency: subscription.Concurrency,
+		retries:     subscription.Retries,
+		backoff:     subscription.Backoff,
+	}
+	if h.concurrency < 1 {
+		h.concurrency = 1
+	}
+	if h.retries > 0 && h.backoff <= 0 {
+		h.backoff = defaultBackoff
+	}
+
+	// Register handler and start if events are running
+	p.RWMutex.Lock()
+	p.handlers = append(p.handlers, h)
+	if p.ctx != nil {
+		p.start(p.ctx, h)
+	}
+	p.RWMutex.Unlock()
+
+	// Return function to remove the handler
+	return func() {
+		p.RWMutex.Lock()
+		for i, other := range p.handlers {
+			if other == h {
+				p.handlers = append(p.handlers[:i], p.handlers[i+1:]...)
+				break
+			}
+		}
+		p.RWMutex.Unlock()
+		p.Unsubscribe(h.ch)
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// start runs goroutines for a handler until the context is done or
+// the handler is removed. It should be called whilst holding the lock
+func (p *events) start(ctx context.Context, h *handler) {
+	for i := 0; i < h.concurrency; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for {
+				select {
+				case evt, ok := <-h.ch:
+					if ok == false {
+						return
+					}
+					p.handle(ctx, h, evt)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+// handle calls the handler for an event, and calls it again after a
+// delay if it fails and retries are set. The delay is doubled for each
+// retry up to maxBackoff, and is waited in the goroutine which called
+// the handler, so that no more than the concurrency of the handler are
+// calling it. When the handler still fails, the error is logged,
+// returned from Run and the event is a dead letter
+func (p *events) handle(ctx context.Context, h *handler, evt graph.State) {
+	attempts, backoff := 1, h.backoff
+	err := h.call(ctx, evt)
+	for err != nil && attempts <= h.retries {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			p.failed(evt, err, attempts)
+			return
+		}
+		attempts, backoff = attempts+1, double(backoff)
+		err = h.call(ctx, evt)
+	}
+	if err != nil {
+		p.failed(evt, err, attempts)
+		p.deadLetter(evt, err, attempts)
+	}
+}
+
+// failed logs a handler error when there is a logger, and appends it
+// to the errors returned from Run
+func (p *events) failed(evt graph.State, err error, attempts int) {
+	if p.Logger != nil {
+		name := "<nil>"
+		if evt != nil {
+			name = evt.Name()
+		}
+		p.Logger.Error("Handler failed", graph.F("state", name), graph.F("attempts", attempts), graph.F("err", err))
+	}
+	p.errs.Append(err)
+}
+
+// call calls the handler function and returns any error, including
+// recovering from a panic
+func (h *handler) call(ctx context.Context, evt graph.State) (err error) {
+	defer func() {
+		if r := recover(); r == nil {
+			return
+		} else if e, ok := r.(error); ok {
+			err = fmt.Errorf("Handler panic: %w", e)
+		} else {
+			err = fmt.Errorf("Handler panic: %v", r)
+		}
+	}()
+	return h.fn(ctx, evt)
+}
+
+// double returns twice the backoff, up to maxBackoff. A backoff which
+// is already longer is not changed
+func double(backoff time.Duration) time.Duration {
+	if backoff >= maxBackoff {
+		return backoff
+	} else if backoff > maxBackoff/2 {
+		return maxBackoff
+	} else {
+		return backoff * 2
+	}
+}
@@ -0,0 +1,101 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// interceptor is a pointer to an interceptor, so that it can be
+// removed from the chain
+type interceptor struct {
+	fn graph.Interceptor
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	errDropped = errors.New("Dropped by interceptor")
+)
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+func (p *events) Intercept(fn graph.Interceptor) func() {
+	i := &interceptor{fn}
+
+	// The chain is replaced rather than modified, so that it can be
+	// called without holding the lock
+	p.RWMutex.Lock()
+	chain := make([]*interceptor, 0, len(p.chain)+1)
+	p.chain = append(append(chain, p.chain...), i)
+	p.RWMutex.Unlock()
+
+	// Return function to remove the interceptor
+	return func() {
+		p.RWMutex.Lock()
+		defer p.RWMutex.Unlock()
+		chain := make([]*interceptor, 0, len(p.chain))
+		for _, other := range p.chain {
+			if other != i {
+				chain = append(chain, other)
+			}
+		}
+		p.chain = chain
+	}
+}
+
+// Enrich returns an interceptor which wraps states in an envelope
+// with the time emitted and the unit which emitted the state, when
+// the context passed to the Run method of the unit is used to emit
+func Enrich() graph.Interceptor {
+	return func(ctx context.Context, s graph.State) (graph.State, error) {
+		if _, ok := s.(*graph.Envelope); ok {
+			return s, nil
+		}
+		return &graph.Envelope{
+			State:  s,
+			Time:   time.Now(),
+			Source: graph.SourceFromContext(ctx),
+		}, nil
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// intercept calls each interceptor in the chain in order, and returns
+// the state to dispatch or nil if the state is dropped
+func (p *events) intercept(ctx context.Context, s graph.State) (graph.State, error) {
+	p.RWMutex.RLock()
+	chain := p.chain
+	p.RWMutex.RUnlock()
+
+	for _, i := range chain {
+		if state, err := i.fn(ctx, s); err != nil {
+			return nil, err
+		} else if state == nil {
+			return nil, nil
+		} else {
+			s = state
+		}
+	}
+	return s, nil
+}
+
+// internal returns true for states used by the events unit, which
+// are not intercepted
+func internal(s graph.State) bool {
+	switch s.(type) {
+	case *barrier, *replay, *request:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,136 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+type lifecycle struct {
+	name string
+	unit interface{}
+}
+
+// barrier is dispatched by the events unit to indicate all
+// previous events have been dispatched
+type barrier struct {
+	done chan struct{}
+	refs int32 // Number of shards which have not dispatched the barrier
+}
+
+/////////////////////////////////////////////////////////////////////
+// METHODS
+
+func (s *lifecycle) Name() string {
+	return s.name
+}
+
+func (s *lifecycle) Value() interface{} {
+	return s.unit
+}
+
+func (s *lifecycle) Priority() graph.Priority {
+	return graph.PriorityHigh
+}
+
+func (s *lifecycle) String() string {
+	return fmt.Sprintf("<%v %v>", s.name, s.unit)
+}
+
+func (*barrier) Name() string {
+	return "<barrier>"
+}
+
+func (*barrier) Value() interface{} {
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// QUEUE
+
+// queue emits lifecycle events in order, without blocking the
+// caller whilst the events unit is dispatching
+type queue struct {
+	sync.Mutex
+
+	q       []entry
+	ready   chan struct{}
+	stopped chan struct{}
+}
+
+// entry is either a state to emit or a channel to close
+// when all previous states have been emitted
+type entry struct {
+	state graph.State
+	done  chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{
+		ready:   make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+}
+
+// push appends a state to the queue
+func (q *queue) push(s graph.State) {
+	q.append(entry{state: s})
+}
+
+// flush waits until all queued states have been emitted, the
+// context is done or the queue has stopped
+func (q *queue) flush(ctx context.Context) {
+	done := make(chan struct{})
+	q.append(entry{done: done})
+	select {
+	case <-done:
+	case <-q.stopped:
+	case <-ctx.Done():
+	}
+}
+
+// run emits queued states until the context is done or the
+// events unit stops dispatching
+func (q *queue) run(ctx context.Context, unit graph.Events) {
+	defer close(q.stopped)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.ready:
+			q.Lock()
+			entries := q.q
+			q.q = nil
+			q.Unlock()
+			for _, entry := range entries {
+				if entry.done != nil {
+					// Wait for events to be dispatched to subscribers
+					if unit, ok := unit.(*events); ok {
+						unit.sync(ctx)
+					}
+					close(entry.done)
+				} else if err := unit.EmitContext(ctx, entry.state); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// append adds an entry to the queue and signals the queue is
+// ready without blocking
+func (q *queue) append(e entry) {
+	q.Lock()
+	q.q = append(q.q, e)
+	q.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
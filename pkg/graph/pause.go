@@ -0,0 +1,155 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/djthorpe/graph"
+	"github.com/hashicorp/go-multierror"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// PAUSE AND RESUME
+
+// Pause calls Pause on units, or on all units if none are provided. Units
+// which depend on other units are paused first, so that dependencies are
+// still running whilst units pause. Units which are already paused are
+// skipped, and a graph.UnitPaused event is emitted for each unit paused.
+// Errors are accumulated so every unit is called. Returns an error if the
+// graph is not running.
+func (g *Graph) Pause(ctx context.Context, units ...interface{}) error {
+	g.pausing.Lock()
+	defer g.pausing.Unlock()
+
+	order, err := g.filter(units)
+	if err != nil {
+		return err
+	}
+
+	// Pause leaf-last
+	var result error
+	for i := len(order) - 1; i >= 0; i-- {
+		if err := g.pause(ctx, order[i], true); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	// Return any errors
+	return result
+}
+
+// Resume calls Resume on paused units, or on all paused units if none
+// are provided. Dependencies are resumed first and a graph.UnitResumed
+// event is emitted for each unit resumed. Errors are accumulated so
+// every unit is called. Returns an error if the graph is not running.
+func (g *Graph) Resume(ctx context.Context, units ...interface{}) error {
+	g.pausing.Lock()
+	defer g.pausing.Unlock()
+
+	order, err := g.filter(units)
+	if err != nil {
+		return err
+	}
+
+	// Resume leaf-first
+	var result error
+	for _, unit := range order {
+		if err := g.pause(ctx, unit, false); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+
+	// Return any errors
+	return result
+}
+
+// IsPaused returns true if a unit has been paused
+func (g *Graph) IsPaused(unit interface{}) bool {
+	g.rt.Lock()
+	defer g.rt.Unlock()
+	if status, exists := g.status[unit]; exists {
+		return status.Paused
+	} else {
+		return false
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// filter returns units leaf-first, or all units if none are provided,
+// or an error if the graph is not running or a unit is not part of the graph
+func (g *Graph) filter(units []interface{}) ([]reflect.Value, error) {
+	g.rt.Lock()
+	running := g.running
+	order := make([]reflect.Value, 0, len(g.statuses))
+	for _, status := range g.statuses {
+		order = append(order, reflect.ValueOf(status.Unit))
+	}
+	g.rt.Unlock()
+	if running == false {
+		return nil, errNotRunning
+	}
+	if len(units) == 0 {
+		return order, nil
+	}
+
+	// Check all units are in the graph
+	match := make(map[interface{}]bool, len(units))
+	for _, unit := range units {
+		match[unit] = false
+	}
+	result := make([]reflect.Value, 0, len(units))
+	for _, unit := range order {
+		if _, exists := match[unit.Interface()]; exists {
+			match[unit.Interface()] = true
+			result = append(result, unit)
+		}
+	}
+	for unit, found := range match {
+		if found == false {
+			return nil, fmt.Errorf("%w: %v", errUnknownUnit, unit)
+		}
+	}
+
+	// Return units in order
+	return result, nil
+}
+
+// pause calls Pause or Resume on a unit if the unit is not already in
+// that state, and emits an event on success. It should be called whilst
+// holding the pausing lock
+func (g *Graph) pause(ctx context.Context, unit reflect.Value, paused bool) error {
+	key := unit.Interface()
+
+	g.rt.Lock()
+	status, exists := g.status[key]
+	if exists && status.Paused == paused {
+		g.rt.Unlock()
+		return nil
+	}
+	g.rt.Unlock()
+
+	// Call Pause or Resume
+	fn, name := "Pause", graph.UnitPaused
+	if paused == false {
+		fn, name = "Resume", graph.UnitResumed
+	}
+	if err := call(fn, unit, []reflect.Value{reflect.ValueOf(ctx)}); err != nil {
+		return err
+	}
+
+	// Set state
+	if exists {
+		g.rt.Lock()
+		status.Paused = paused
+		g.rt.Unlock()
+	}
+
+	// Emit event
+	g.emit(name, key)
+
+	// Return success
+	return nil
+}
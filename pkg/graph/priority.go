@@ -0,0 +1,98 @@
+package graph
+
+import (
+	"context"
+	"time"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// queued is a state waiting in a lane, with the time it was emitted
+type queued struct {
+	state graph.State
+	time  time.Time
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// laneBuffer is the number of states which can wait in each lane
+const (
+	laneBuffer = 1024
+)
+
+// Each priority has a lane, with the highest priority first
+var (
+	priorities = []graph.Priority{graph.PriorityHigh, graph.PriorityNormal, graph.PriorityLow}
+)
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// newLanes returns a channel for each priority
+func newLanes() []chan queued {
+	lanes := make([]chan queued, len(priorities))
+	for i := range lanes {
+		lanes[i] = make(chan queued, laneBuffer)
+	}
+	return lanes
+}
+
+// lane returns the index of the lane for a state. The priority of a
+// state wrapped by an envelope or request is used
+func lane(s graph.State) int {
+	priority := graph.PriorityNormal
+	for s != nil {
+		if p, ok := s.(graph.Prioritized); ok {
+			priority = p.Priority()
+			break
+		}
+		if w, ok := s.(interface{ Unwrap() graph.State }); ok {
+			s = w.Unwrap()
+		} else {
+			break
+		}
+	}
+	for i, p := range priorities {
+		if priority >= p {
+			return i
+		}
+	}
+	return len(priorities) - 1
+}
+
+// next returns the next state to dispatch, waiting for a state if
+// necessary. When states are waiting in more than one lane, the state
+// with the highest priority is returned
+func next(ctx context.Context, lanes []chan queued) (queued, error) {
+	if q := poll(lanes); q.state != nil {
+		return q, nil
+	}
+	// There is a lane for each priority
+	select {
+	case q := <-lanes[0]:
+		return q, nil
+	case q := <-lanes[1]:
+		return q, nil
+	case q := <-lanes[2]:
+		return q, nil
+	case <-ctx.Done():
+		return queued{}, ctx.Err()
+	}
+}
+
+// poll returns a state which is waiting to be dispatched, highest
+// priority first, or a nil state if no state is waiting
+func poll(lanes []chan queued) queued {
+	for _, lane := range lanes {
+		select {
+		case q := <-lane:
+			return q
+		default:
+		}
+	}
+	return queued{}
+}
@@ -13,8 +13,9 @@ import (
 // GLOBALS
 
 var (
-	unitType = reflect.TypeOf((*graph.Unit)(nil)).Elem()
-	logType  = reflect.TypeOf((*graph.Logger)(nil)).Elem()
+	unitType   = reflect.TypeOf((*graph.Unit)(nil)).Elem()
+	logType    = reflect.TypeOf((*graph.Logger)(nil)).Elem()
+	eventsType = reflect.TypeOf((*graph.Events)(nil)).Elem()
 )
 
 /////////////////////////////////////////////////////////////////////
@@ -74,6 +75,25 @@ func forEachField(unit reflect.Value, immediate bool, fn func(reflect.StructFiel
 	return result
 }
 
+// namedLogger returns a logger named with the type of a unit, or the
+// logger unit if it cannot be named
+func namedLogger(logger reflect.Value, unit reflect.Type) reflect.Value {
+	if named, ok := logger.Interface().(graph.NamedLogger); ok {
+		return reflect.ValueOf(named.Named(unitName(unit)))
+	} else {
+		return logger
+	}
+}
+
+// unitName returns the package and name of a unit type, such as
+// "mypkg.Store"
+func unitName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.String()
+}
+
 // call will call a function on a struct and pass arguments
 // but expects the first returned argument to be an error, or
 // empty return
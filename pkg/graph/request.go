@@ -0,0 +1,168 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// request wraps a state emitted by Request with a correlation ID,
+// so that the reply can be returned to the requester
+type request struct {
+	graph.State
+	id uint64
+}
+
+// reply is returned to a requester by a responder
+type reply struct {
+	state graph.State
+	err   error
+}
+
+// responder replies to requests with names matching a topic
+type responder struct {
+	*topic
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	errResponderPanic = errors.New("Responder panic")
+)
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+func (p *events) Request(ctx context.Context, s graph.State) (graph.State, error) {
+	// Use NullState when s is nil, and call interceptors
+	if s == nil {
+		s = NullState()
+	}
+	if state, err := p.intercept(ctx, s); err != nil {
+		return nil, err
+	} else if state == nil {
+		return nil, errDropped
+	} else {
+		s = state
+	}
+
+	// Check for a responder and register the request
+	ch := make(chan *reply, 1)
+	p.RWMutex.Lock()
+	if p.responds(s.Name()) == false {
+		p.RWMutex.Unlock()
+		return nil, graph.ErrNoResponder
+	}
+	p.id++
+	id := p.id
+	p.pending[id] = ch
+	p.RWMutex.Unlock()
+
+	// Remove the request on return
+	defer func() {
+		p.RWMutex.Lock()
+		delete(p.pending, id)
+		p.RWMutex.Unlock()
+	}()
+
+	// Emit the request and wait for a reply
+	if err := p.EmitContext(ctx, &request{s, id}); err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-ch:
+		return r.state, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *events) Respond(topic string, fn graph.Responder) func() {
+	r := &responder{newTopic(topic)}
+
+	// Register the responder
+	p.RWMutex.Lock()
+	p.responders = append(p.responders, r)
+	p.RWMutex.Unlock()
+
+	// Handle requests, ignoring any other events
+	remove := p.Handle(graph.Subscription{Topics: []string{topic}}, func(ctx context.Context, evt graph.State) error {
+		req, ok := evt.(*request)
+		if ok == false {
+			return nil
+		}
+
+		// Reply to the requester if the responder panics, and then
+		// report the panic
+		defer func() {
+			if r := recover(); r != nil {
+				p.reply(req.id, nil, errResponderPanic)
+				panic(r)
+			}
+		}()
+
+		state, err := fn(ctx, req.State)
+		p.reply(req.id, state, err)
+		return nil
+	})
+
+	// Return function to remove the responder
+	return func() {
+		p.RWMutex.Lock()
+		for i, other := range p.responders {
+			if other == r {
+				p.responders = append(p.responders[:i], p.responders[i+1:]...)
+				break
+			}
+		}
+		p.RWMutex.Unlock()
+		remove()
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// STATE
+
+// Unwrap returns the state which was requested
+func (r *request) Unwrap() graph.State {
+	return r.State
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (r *request) String() string {
+	return fmt.Sprintf("<request id=%v name=%q>", r.id, r.Name())
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// responds returns true if there is a responder for a name. It should
+// be called whilst holding the lock
+func (p *events) responds(name string) bool {
+	for _, r := range p.responders {
+		if r.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// reply returns a reply to a requester. The first reply is returned
+// and any further replies are discarded
+func (p *events) reply(id uint64, state graph.State, err error) {
+	p.RWMutex.Lock()
+	defer p.RWMutex.Unlock()
+
+	if ch, exists := p.pending[id]; exists {
+		delete(p.pending, id)
+		ch <- &reply{state, err}
+	}
+}
@@ -0,0 +1,99 @@
+package graph
+
+import (
+	"context"
+	"sort"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// replay is emitted when a subscriber is created, so that retained
+// states are dispatched to it without waiting for another event
+type replay struct {
+	s *subscriber
+}
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+func (p *events) Retain(topics ...string) {
+	p.RWMutex.Lock()
+	defer p.RWMutex.Unlock()
+
+	for _, name := range topics {
+		p.retain = append(p.retain, newTopic(name))
+	}
+	p.update()
+}
+
+func (p *events) ClearRetained(names ...string) {
+	p.RWMutex.Lock()
+	defer p.RWMutex.Unlock()
+
+	if len(names) == 0 {
+		p.retained = make(map[string]graph.State)
+	}
+	for _, name := range names {
+		delete(p.retained, name)
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// STATE
+
+func (*replay) Name() string {
+	return "<replay>"
+}
+
+func (*replay) Value() interface{} {
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// retainState keeps the state if the name matches a retained topic,
+// except for internal states. It should be called whilst holding the lock
+func (p *events) retainState(evt graph.State) {
+	if internal(evt) {
+		return
+	}
+	for _, t := range p.retain {
+		if t.match(evt.Name()) {
+			p.retained[evt.Name()] = evt
+			return
+		}
+	}
+}
+
+// retainedFor returns the retained states matching a subscriber. It
+// should be called whilst holding the lock
+func (p *events) retainedFor(s *subscriber) []graph.State {
+	var result []graph.State
+	for name, evt := range p.retained {
+		if s.match(name) {
+			result = append(result, evt)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result
+}
+
+// replay sends retained states to a subscriber before any other event,
+// and returns false if the subscriber should be disconnected. It is
+// only called by the dispatcher
+func (p *events) replay(ctx context.Context, s *subscriber) bool {
+	for len(s.retained) > 0 {
+		evt := s.retained[0]
+		s.retained = s.retained[1:]
+		if s.send(ctx, evt) == disconnected {
+			return false
+		}
+	}
+	return true
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/djthorpe/graph"
 	"github.com/hashicorp/go-multierror"
 )
 
@@ -17,7 +18,10 @@ type RunContext struct {
 	sync.Mutex
 
 	parent         context.Context
+	graph          *Graph
 	done, finished chan struct{}
+	stopped, exit  chan struct{}
+	once           sync.Once
 	cancels        []context.CancelFunc
 	all, objs      sync.WaitGroup
 	result         *Error
@@ -33,20 +37,80 @@ type Error struct {
 
 // Run is called to initiate goroutines for each unit and waits until
 // all "obj" run functions end. The order of
-// running unit run functions is not guaranteed. Any errors from
-// Run returns are collected and returned.
+// running unit run functions is not guaranteed. Before the
+// run functions are cancelled, units are drained leaf-last whilst
+// their dependencies are still running. Any errors from
+// Run and Drain returns are collected and returned. Run can be called
+// again once it has returned, without calling Define or New again.
 func (g *Graph) Run(ctx context.Context) error {
+	return g.run(ctx, nil)
+}
+
+// Start runs the graph in the background, and returns an error if the
+// graph is already running. Call Stop to end running and collect any
+// errors.
+func (g *Graph) Start(ctx context.Context) error {
+	g.rt.Lock()
+	if g.running || g.starting {
+		g.rt.Unlock()
+		return errRunning
+	}
+	g.starting = true
+	g.rt.Unlock()
+
+	// Wait until the graph is running before returning
+	started := make(chan struct{})
+	go g.run(ctx, started)
+	<-started
+
+	// Return success
+	return nil
+}
+
+// Stop ends running the graph, as if all "obj" run functions had ended, and
+// waits for units to drain and all run functions to return. It returns any
+// errors collected whilst running, and can be called on a graph started with
+// either Run or Start.
+func (g *Graph) Stop() error {
+	g.rt.Lock()
+	child := g.child
+	g.rt.Unlock()
+	if child == nil {
+		return errNotRunning
+	}
+
+	// Signal stop and wait for Run to return
+	child.stop()
+	<-child.exit
+
+	// Return collected errors
+	return child.Err()
+}
+
+// run initiates goroutines for each unit, closes started once all run
+// functions have been called and waits for the end of run condition
+func (g *Graph) run(ctx context.Context, started chan<- struct{}) error {
 	g.RWMutex.Lock()
 	defer g.RWMutex.Unlock()
 
 	// Create context which allows units to run
-	child := NewContext(ctx)
+	child := newContext(ctx, g)
+	defer close(child.exit)
+
+	// Set running state, which emits lifecycle events
+	g.setRunning(child)
+	defer g.setRunning(nil)
 
 	// Call run functions for objects and units
 	seen := make(map[reflect.Type]bool, len(g.units))
 	for _, obj := range g.objs {
 		g.do("Run", obj, []reflect.Value{reflect.ValueOf(child)}, seen, true)
 	}
+	g.setScheduled()
+	child.start()
+	if started != nil {
+		close(started)
+	}
 
 	// Wait for end of run condition
 	<-child.Done()
@@ -55,15 +119,118 @@ func (g *Graph) Run(ctx context.Context) error {
 	return child.Err()
 }
 
+// setRunning sets the runtime state, or clears it when the context
+// is nil. Whilst running, lifecycle events are emitted in the
+// background when there is an events unit in the graph
+func (g *Graph) setRunning(child *RunContext) {
+	g.rt.Lock()
+	defer g.rt.Unlock()
+
+	running := child != nil
+	g.child, g.starting = child, false
+	g.running, g.scheduled, g.ready = running, false, false
+	if g.cancel != nil {
+		g.cancel()
+		<-g.queue.stopped
+		g.queue, g.cancel = nil, nil
+	}
+	if unit := g.Events(); unit != nil && running {
+		// Allow lifecycle events to be emitted before the events unit runs
+		if unit, ok := unit.(*events); ok {
+			unit.RWMutex.Lock()
+			unit.open()
+			unit.RWMutex.Unlock()
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		g.queue, g.cancel = newQueue(), cancel
+		go g.queue.run(ctx, unit)
+	}
+}
+
+// setScheduled is called when all Run methods have been scheduled,
+// so that GraphReady can be emitted once they have all started
+func (g *Graph) setScheduled() {
+	g.rt.Lock()
+	defer g.rt.Unlock()
+
+	g.scheduled = true
+	g.setReady()
+}
+
+// setReady emits GraphReady once all Run methods have been called,
+// and should be called whilst holding the runtime lock
+func (g *Graph) setReady() {
+	if g.running == false || g.scheduled == false || g.ready {
+		return
+	}
+	for _, status := range g.statuses {
+		if status.State == StateStarting {
+			return
+		}
+	}
+	g.ready = true
+	g.push(graph.GraphReady, g)
+}
+
+// stopping emits GraphStopping and waits for lifecycle events to be
+// emitted before units are drained, bounded by the drain timeout
+func (g *Graph) stopping() {
+	g.rt.Lock()
+	g.push(graph.GraphStopping, g)
+	queue := g.queue
+	g.rt.Unlock()
+
+	if queue != nil && g.drain > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), g.drain)
+		defer cancel()
+		queue.flush(ctx)
+	}
+}
+
+// drainAll calls Drain on units leaf-last, bounded by the drain
+// timeout. Errors are accumulated so every unit is drained.
+func (g *Graph) drainAll() error {
+	if g.drain <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), g.drain)
+	defer cancel()
+
+	var result error
+	seen := make(map[reflect.Type]bool, len(g.units))
+	for _, obj := range g.objs {
+		if err := g.do("Drain", obj, []reflect.Value{reflect.ValueOf(ctx)}, seen, true); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // CONTEXT
 
 func NewContext(parent context.Context) context.Context {
+	c := newContext(parent, nil)
+	c.start()
+	return c
+}
+
+func newContext(parent context.Context, g *Graph) *RunContext {
 	c := new(RunContext)
 	c.parent = parent
+	c.graph = g
 	c.done, c.finished = make(chan struct{}), make(chan struct{})
+	c.stopped, c.exit = make(chan struct{}), make(chan struct{})
 	c.result = new(Error)
 
+	// Return context
+	return c
+}
+
+// start waits for the end of run condition in the background. It
+// should be called once all Run methods have been started
+func (c *RunContext) start() {
 	// Wait for either parent to signal done, or all objects
 	// to have completed their Run methods
 	go func() {
@@ -72,6 +239,16 @@ func NewContext(parent context.Context) context.Context {
 			c.result.Append(c.parent.Err())
 		case <-c.finished:
 			// Finished comes about when all root obj have finished
+		case <-c.stopped:
+			// Stopped comes about when Stop is called
+		}
+
+		// Drain units before cancelling Run methods
+		if c.graph != nil {
+			c.graph.stopping()
+			if err := c.graph.drainAll(); err != nil {
+				c.result.Append(err)
+			}
 		}
 
 		// Send cancels to Run methods
@@ -89,14 +266,19 @@ func NewContext(parent context.Context) context.Context {
 	}()
 
 	// Wait for all object Run methods to complete and then
-	// send finish signal
+	// signal finish, which also ends when Run methods are cancelled
 	go func() {
 		c.objs.Wait()
-		c.finished <- struct{}{}
+		close(c.finished)
 	}()
+}
 
-	// Return context
-	return c
+// stop signals the end of run condition, as if all root obj
+// had finished
+func (c *RunContext) stop() {
+	c.once.Do(func() {
+		close(c.stopped)
+	})
 }
 
 func (c *RunContext) Done() <-chan struct{} {
@@ -108,28 +290,35 @@ func (c *RunContext) Deadline() (deadline time.Time, ok bool) {
 }
 
 func (c *RunContext) Run(unit reflect.Value, obj bool) {
-	// Create a context which can be cancelled
-	child, cancel := context.WithCancel(context.Background())
+	// Create a context which can be cancelled, with the unit as the
+	// source of any states emitted with the context
+	child, cancel := context.WithCancel(graph.WithSource(context.Background(), unit.Interface()))
 
 	// Append cancels, this occurs sequentially so no need to guard
 	c.Mutex.Lock()
 	defer c.Mutex.Unlock()
-	c.cancels = append(c.cancels, cancel)
+	c.cancels = append(c.cancels, func() {
+		c.graph.setState(unit, StateStopping, nil)
+		cancel()
+	})
 
 	// In goroutine, call Run and pass back the result
 	if obj {
 		c.objs.Add(1)
 	}
 	c.all.Add(1)
+	c.graph.setState(unit, StateStarting, nil)
 	go func() {
 		defer c.all.Done()
 		if obj {
 			defer c.objs.Done()
 		}
-		if err := call("Run", unit, []reflect.Value{reflect.ValueOf(child)}); err != nil {
-			if errors.Is(err, context.Canceled) == false {
-				c.result.Append(err)
-			}
+		c.graph.setState(unit, StateRunning, nil)
+		if err := call("Run", unit, []reflect.Value{reflect.ValueOf(child)}); err != nil && errors.Is(err, context.Canceled) == false {
+			c.result.Append(err)
+			c.graph.setState(unit, StateFailed, err)
+		} else {
+			c.graph.setState(unit, StateStopped, nil)
 		}
 	}()
 }
@@ -161,6 +350,14 @@ func (r *Error) Unwrap() error {
 	return r.err.Unwrap()
 }
 
+// ErrorOrNil returns all errors collected, or nil if there are none
+func (r *Error) ErrorOrNil() error {
+	r.Mutex.Lock()
+	defer r.Mutex.Unlock()
+
+	return r.err.ErrorOrNil()
+}
+
 func (r *Error) Error() string {
 	return r.Unwrap().Error()
 }
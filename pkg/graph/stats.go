@@ -0,0 +1,179 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// counters are updated atomically for each state name
+type counters struct {
+	emitted, delivered, dropped uint64
+}
+
+// histogram counts durations in buckets with the latencyBounds, and
+// is updated atomically so should be allocated for alignment
+type histogram struct {
+	counts [len(latencyBounds) + 1]uint64
+	count  uint64
+	sum    uint64
+}
+
+// stats is the state emitted periodically with event statistics
+type stats struct {
+	graph.EventStats
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// latencySample is the number of states emitted for each state whose
+// latency is measured, and maxTopics is the number of state names which
+// are counted, including graph.OtherTopics
+const (
+	latencySample = 16
+	maxTopics     = 1024
+)
+
+// latencyBounds are the upper bounds of the latency buckets
+var latencyBounds = [...]time.Duration{
+	time.Microsecond,
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+}
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+func (p *events) Stats() graph.EventStats {
+	result := graph.EventStats{
+		Topics:  make(map[string]graph.TopicStats),
+		Latency: p.latency.snapshot(),
+	}
+
+	// Count states waiting to be dispatched, and each subscriber
+	p.RWMutex.RLock()
+	for _, lane := range p.lanes {
+		result.Queued += len(lane)
+	}
+	for _, s := range p.subs {
+		result.Subscribers = append(result.Subscribers, s.stats())
+	}
+	p.RWMutex.RUnlock()
+
+	// Count each topic
+	p.topics.Range(func(name, c interface{}) bool {
+		result.Topics[name.(string)] = c.(*counters).stats()
+		return true
+	})
+
+	return result
+}
+
+/////////////////////////////////////////////////////////////////////
+// STATE
+
+func (*stats) Name() string {
+	return graph.EventsStats
+}
+
+func (s *stats) Value() interface{} {
+	return s.EventStats
+}
+
+func (*stats) Priority() graph.Priority {
+	return graph.PriorityLow
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// counters returns the counters for a state name, or the counters for
+// graph.OtherTopics when the maximum number of names are counted
+func (p *events) counters(name string) *counters {
+	if c, exists := p.topics.Load(name); exists {
+		return c.(*counters)
+	}
+	if name != graph.OtherTopics && atomic.LoadInt32(&p.ntopics) >= maxTopics-1 {
+		return p.counters(graph.OtherTopics)
+	}
+	c, loaded := p.topics.LoadOrStore(name, new(counters))
+	if loaded == false {
+		atomic.AddInt32(&p.ntopics, 1)
+	}
+	return c.(*counters)
+}
+
+// emitStats emits statistics at an interval until the context is done
+func (p *events) emitStats(ctx context.Context, interval time.Duration) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.EmitContext(ctx, &stats{p.Stats()})
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stats returns the counters for a topic
+func (c *counters) stats() graph.TopicStats {
+	return graph.TopicStats{
+		Emitted:   atomic.LoadUint64(&c.emitted),
+		Delivered: atomic.LoadUint64(&c.delivered),
+		Dropped:   atomic.LoadUint64(&c.dropped),
+	}
+}
+
+// record adds a duration to the histogram
+func (h *histogram) record(d time.Duration) {
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddUint64(&h.sum, uint64(d))
+}
+
+// snapshot returns the counts in the histogram
+func (h *histogram) snapshot() graph.Histogram {
+	result := graph.Histogram{
+		Bounds: append([]time.Duration(nil), latencyBounds[:]...),
+		Counts: make([]uint64, len(h.counts)),
+		Count:  atomic.LoadUint64(&h.count),
+		Sum:    time.Duration(atomic.LoadUint64(&h.sum)),
+	}
+	for i := range h.counts {
+		result.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return result
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (s *stats) String() string {
+	var topics []string
+	for name, c := range s.Topics {
+		topics = append(topics, fmt.Sprintf("%v=%v/%v/%v", name, c.Emitted, c.Delivered, c.Dropped))
+	}
+	sort.Strings(topics)
+	return fmt.Sprintf("<%v %v topics=[%v]>", graph.EventsStats, s.EventStats, strings.Join(topics, " "))
+}
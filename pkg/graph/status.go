@@ -0,0 +1,194 @@
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/djthorpe/graph"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// UnitState is the lifecycle state of a unit
+type UnitState uint
+
+// Status is a snapshot of the lifecycle state of a unit
+type Status struct {
+	Unit   interface{}             // Unit is the object or unit
+	State  UnitState               // State is the current lifecycle state
+	Since  time.Time               // Since is the time the current state was entered
+	Times  map[UnitState]time.Time // Times contains the time each state was last entered
+	Err    error                   // Err is the last error returned by the unit
+	Paused bool                    // Paused is true if the unit has been paused
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	StateCreated     UnitState = iota // Unit has been created by New
+	StateDefined                      // Define has been called
+	StateInitialized                  // New has returned without error
+	StateStarting                     // Run goroutine has been scheduled
+	StateRunning                      // Run method has been called
+	StateStopping                     // Run method has been cancelled
+	StateStopped                      // Run method has returned without error
+	StateFailed                       // New or Run method returned an error
+	StateDisposed                     // Dispose has been called
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// STATUS
+
+// Status returns the status of all objects and units, with leaf
+// units first
+func (g *Graph) Status() []Status {
+	g.rt.Lock()
+	defer g.rt.Unlock()
+
+	result := make([]Status, 0, len(g.statuses))
+	for _, status := range g.statuses {
+		result = append(result, status.copy())
+	}
+	return result
+}
+
+// StatusOf returns the status of an object or unit, or nil if
+// the unit is not part of the graph
+func (g *Graph) StatusOf(unit interface{}) *Status {
+	g.rt.Lock()
+	defer g.rt.Unlock()
+
+	if status, exists := g.status[unit]; exists == false {
+		return nil
+	} else {
+		status := status.copy()
+		return &status
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// newStatus sets all objects and units into created state
+func (g *Graph) newStatus() {
+	order := g.order()
+	now := time.Now()
+
+	g.status = make(map[interface{}]*Status, len(order))
+	g.statuses = make([]*Status, 0, len(order))
+	for _, unit := range order {
+		key := unit.Interface()
+		if _, exists := g.status[key]; exists {
+			continue
+		}
+		status := &Status{
+			Unit:  key,
+			State: StateCreated,
+			Since: now,
+			Times: map[UnitState]time.Time{StateCreated: now},
+		}
+		g.status[key] = status
+		g.statuses = append(g.statuses, status)
+	}
+}
+
+// setState moves a unit into a new state, records any error and emits
+// a lifecycle event whilst the graph is running. Moving
+// into running state is ignored unless the unit is starting, and moving
+// into stopping state is ignored unless the unit is starting or running.
+func (g *Graph) setState(unit reflect.Value, state UnitState, err error) {
+	if g == nil {
+		return
+	}
+
+	g.rt.Lock()
+	defer g.rt.Unlock()
+
+	status, exists := g.status[unit.Interface()]
+	if exists == false {
+		return
+	}
+	if state == StateStopping && status.State != StateStarting && status.State != StateRunning {
+		return
+	}
+	if state == StateRunning && status.State != StateStarting {
+		return
+	}
+	if err != nil {
+		status.Err = err
+	}
+	now := time.Now()
+	status.State = state
+	status.Since = now
+	status.Times[state] = now
+
+	// Emit lifecycle events whilst running
+	switch state {
+	case StateRunning:
+		g.push(graph.UnitStarted, status.Unit)
+	case StateStopping:
+		g.push(graph.UnitStopping, status.Unit)
+	case StateStopped:
+		g.push(graph.UnitStopped, status.Unit)
+	case StateFailed:
+		g.push(graph.UnitFailed, status.Unit)
+	}
+	g.setReady()
+}
+
+// copy returns a snapshot of the status
+func (s *Status) copy() Status {
+	other := *s
+	other.Times = make(map[UnitState]time.Time, len(s.Times))
+	for k, v := range s.Times {
+		other.Times[k] = v
+	}
+	return other
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (s UnitState) String() string {
+	switch s {
+	case StateCreated:
+		return "created"
+	case StateDefined:
+		return "defined"
+	case StateInitialized:
+		return "initialized"
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateStopping:
+		return "stopping"
+	case StateStopped:
+		return "stopped"
+	case StateFailed:
+		return "failed"
+	case StateDisposed:
+		return "disposed"
+	default:
+		return "[?? Invalid UnitState value]"
+	}
+}
+
+func (s Status) String() string {
+	str := "<status"
+	str += fmt.Sprintf(" unit=%v", reflect.TypeOf(s.Unit))
+	str += fmt.Sprint(" state=", s.State)
+	if s.Paused {
+		str += " paused"
+	}
+	if s.Since.IsZero() == false {
+		str += fmt.Sprint(" since=", s.Since.Format(time.RFC3339))
+	}
+	if s.Err != nil {
+		str += fmt.Sprintf(" err=%q", s.Err.Error())
+	}
+	return str + ">"
+}
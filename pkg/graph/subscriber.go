@@ -0,0 +1,181 @@
+package graph
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// subscriber receives events with names matching topics, or all
+// events if there are no topics
+type subscriber struct {
+	dropped   uint64 // Accessed atomically, so first for alignment
+	delivered uint64 // Accessed atomically
+	sync.Mutex
+
+	ch       chan graph.State
+	topics   []string
+	overflow graph.Overflow
+	exact    []string   // Exact names
+	patterns [][]string // Wildcard patterns, split into segments
+	done     chan struct{}
+	once     sync.Once
+	closed   bool
+	retained []graph.State // Retained states, sent before other events
+	shard    int           // Shard which dispatches to the subscriber
+}
+
+// result is the outcome of sending a state to a subscriber
+type result int
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	delivered    result = iota // Received by the subscriber
+	dropped                    // Not received by the subscriber
+	disconnected               // Not received, and the subscriber should be disconnected
+)
+
+/////////////////////////////////////////////////////////////////////
+// NEW
+
+// newSubscriber returns a subscriber for topics, or for all events
+// if there are no topics
+func newSubscriber(subscription graph.Subscription) *subscriber {
+	s := new(subscriber)
+	s.ch = make(chan graph.State, subscription.Buffer)
+	s.overflow = subscription.Overflow
+	s.done = make(chan struct{})
+
+	seen := make(map[string]bool, len(subscription.Topics))
+	for _, topic := range subscription.Topics {
+		if _, exists := seen[topic]; exists {
+			continue
+		} else {
+			seen[topic] = true
+			s.topics = append(s.topics, topic)
+		}
+		if isPattern(topic) {
+			s.patterns = append(s.patterns, strings.Split(topic, topicSeparator))
+		} else {
+			s.exact = append(s.exact, topic)
+		}
+	}
+	return s
+}
+
+/////////////////////////////////////////////////////////////////////
+// METHODS
+
+// match returns true if the name matches any topic
+func (s *subscriber) match(name string) bool {
+	if len(s.exact) == 0 && len(s.patterns) == 0 {
+		return true
+	}
+	return matchTopics(name, s.exact, s.patterns)
+}
+
+// send dispatches an event according to the overflow policy, and
+// returns whether it was delivered or the subscriber should be
+// disconnected
+func (s *subscriber) send(ctx context.Context, evt graph.State) result {
+	s.Lock()
+	defer s.Unlock()
+
+	// Don't send on a closed channel
+	if s.closed {
+		return dropped
+	}
+
+	// Send without waiting when the subscriber is ready
+	select {
+	case s.ch <- evt:
+		atomic.AddUint64(&s.delivered, 1)
+		return delivered
+	default:
+	}
+
+	switch s.overflow {
+	case graph.OverflowDropNewest:
+		select {
+		case s.ch <- evt:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			return dropped
+		}
+	case graph.OverflowDropOldest:
+		for {
+			select {
+			case s.ch <- evt:
+				atomic.AddUint64(&s.delivered, 1)
+				return delivered
+			default:
+				// An unbuffered channel has no oldest event to discard
+				if cap(s.ch) == 0 {
+					atomic.AddUint64(&s.dropped, 1)
+					return dropped
+				}
+				select {
+				case <-s.ch:
+					atomic.AddUint64(&s.dropped, 1)
+				default:
+				}
+			}
+		}
+	case graph.OverflowDisconnect:
+		select {
+		case s.ch <- evt:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			return disconnected
+		}
+	default:
+		select {
+		case s.ch <- evt:
+		case <-s.done:
+			return dropped
+		case <-ctx.Done():
+			atomic.AddUint64(&s.dropped, 1)
+			return dropped
+		}
+	}
+
+	// Return success
+	atomic.AddUint64(&s.delivered, 1)
+	return delivered
+}
+
+// close stops dispatching to the subscriber and closes the channel.
+// Any blocked send is released before the channel is closed.
+func (s *subscriber) close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.Lock()
+		defer s.Unlock()
+		s.closed = true
+		close(s.ch)
+	})
+}
+
+// Dropped returns the number of events discarded
+func (s *subscriber) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// stats returns the counters for the subscriber
+func (s *subscriber) stats() graph.SubscriberStats {
+	return graph.SubscriberStats{
+		Topics:    append([]string(nil), s.topics...),
+		Buffer:    cap(s.ch),
+		Lag:       len(s.ch),
+		Delivered: atomic.LoadUint64(&s.delivered),
+		Dropped:   s.Dropped(),
+	}
+}
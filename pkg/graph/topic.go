@@ -0,0 +1,167 @@
+package graph
+
+import (
+	"strings"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// index is used by the dispatcher to find subscribers for an event
+// without matching every subscriber against the event name
+type index struct {
+	all   []*subscriber
+	exact map[string][]*subscriber
+	wild  []*subscriber
+}
+
+// topic matches names against an exact name or a pattern
+type topic struct {
+	name     string
+	segments []string // Segments when the topic is a pattern
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	topicSeparator = "."
+	topicOne       = "*" // Matches exactly one segment
+	topicAny       = "#" // Matches zero or more segments
+)
+
+/////////////////////////////////////////////////////////////////////
+// INDEX
+
+// newIndex returns an index of subscribers
+func newIndex(subs []*subscriber) *index {
+	i := &index{exact: make(map[string][]*subscriber)}
+	for _, s := range subs {
+		switch {
+		case len(s.patterns) > 0:
+			i.wild = append(i.wild, s)
+		case len(s.exact) > 0:
+			for _, name := range s.exact {
+				i.exact[name] = append(i.exact[name], s)
+			}
+		default:
+			i.all = append(i.all, s)
+		}
+	}
+	return i
+}
+
+// each calls a function for each subscriber matching a name
+func (i *index) each(name string, fn func(*subscriber)) {
+	for _, s := range i.all {
+		fn(s)
+	}
+	for _, s := range i.exact[name] {
+		fn(s)
+	}
+	for _, s := range i.wild {
+		if s.match(name) {
+			fn(s)
+		}
+	}
+}
+
+// has returns true if any subscriber matches a name
+func (i *index) has(name string) bool {
+	if len(i.all) > 0 || len(i.exact[name]) > 0 {
+		return true
+	}
+	for _, s := range i.wild {
+		if s.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+/////////////////////////////////////////////////////////////////////
+// TOPIC
+
+// MatchTopic returns true if a state name matches a topic, which is
+// either an exact name or a pattern with "*" and "#" segments
+func MatchTopic(topic, name string) bool {
+	return newTopic(topic).match(name)
+}
+
+// newTopic returns a topic for an exact name or a pattern
+func newTopic(name string) *topic {
+	t := &topic{name: name}
+	if isPattern(name) {
+		t.segments = strings.Split(name, topicSeparator)
+	}
+	return t
+}
+
+// match returns true if the name matches the topic
+func (t *topic) match(name string) bool {
+	if t.segments == nil {
+		return t.name == name
+	} else {
+		return matchSegments(t.segments, strings.Split(name, topicSeparator))
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// matchTopics returns true if the name matches any exact topic
+// or pattern
+func matchTopics(name string, exact []string, patterns [][]string) bool {
+	for _, topic := range exact {
+		if topic == name {
+			return true
+		}
+	}
+	if len(patterns) > 0 {
+		segments := strings.Split(name, topicSeparator)
+		for _, pattern := range patterns {
+			if matchSegments(pattern, segments) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isPattern returns true if a topic contains wildcard segments
+func isPattern(topic string) bool {
+	for _, segment := range strings.Split(topic, topicSeparator) {
+		if segment == topicOne || segment == topicAny {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments returns true if name segments match pattern segments,
+// where "*" matches exactly one segment and "#" matches zero or more
+// segments
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case topicAny:
+			// Match the remaining pattern against every suffix of the name
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case topicOne:
+			if len(name) == 0 {
+				return false
+			}
+		default:
+			if len(name) == 0 || pattern[0] != name[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
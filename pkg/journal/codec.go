@@ -0,0 +1,52 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// JSON encodes states as JSON objects with a name and value. Values
+// are decoded as generic JSON values, so unlike the codecs in the
+// codec package, states do not need to be registered
+type JSON struct{}
+
+// State is a state decoded from a journal
+type State struct {
+	N string      `json:"name"`
+	V interface{} `json:"value,omitempty"`
+}
+
+/////////////////////////////////////////////////////////////////////
+// JSON
+
+func (JSON) Marshal(s graph.State) ([]byte, error) {
+	return json.Marshal(&State{s.Name(), s.Value()})
+}
+
+func (JSON) Unmarshal(data []byte) (graph.State, error) {
+	s := new(State)
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// STATE
+
+func (s *State) Name() string {
+	return s.N
+}
+
+func (s *State) Value() interface{} {
+	return s.V
+}
+
+func (s *State) String() string {
+	return fmt.Sprintf("<state name=%q value=%v>", s.N, s.V)
+}
@@ -0,0 +1,197 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/djthorpe/graph"
+	"github.com/djthorpe/graph/pkg/codec"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Journal records states emitted on the events unit to a file, or
+// replays states from a file. Set the path with the -journal flag to
+// record, and the -journal.replay flag to replay
+type Journal struct {
+	graph.Unit
+	graph.Events
+
+	Path   string      // Path to record states to
+	Replay string      // Path to replay states from
+	Speed  float64     // Speed of replay, or zero to replay without delay
+	Codec  codec.Codec // Codec for states, codec.JSON by default
+
+	f  *os.File
+	w  *Writer
+	ch <-chan graph.State
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// DefaultBuffer is the number of states buffered whilst recording
+	DefaultBuffer = 100
+
+	// lifecyclePrefix is the prefix for lifecycle states, which are
+	// not recorded as they are emitted by the graph on replay
+	lifecyclePrefix = "graph."
+)
+
+/////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+func (j *Journal) Define(state graph.State) {
+	if j.Speed == 0 {
+		j.Speed = 1
+	}
+	if flags, ok := state.Value().(*flag.FlagSet); ok {
+		flags.StringVar(&j.Path, "journal", j.Path, "Record events to a journal file")
+		flags.StringVar(&j.Replay, "journal.replay", j.Replay, "Replay events from a journal file")
+		flags.Float64Var(&j.Speed, "journal.speed", j.Speed, "Speed of replay, or zero for no delay")
+	}
+}
+
+func (j *Journal) New(graph.State) error {
+	if j.Codec == nil {
+		j.Codec = codec.JSON{}
+	}
+
+	// Subscribe to states so that none are missed when recording
+	if j.Path != "" {
+		if f, err := os.OpenFile(j.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+			return err
+		} else {
+			j.f, j.w = f, NewWriter(f, j.Codec)
+		}
+		j.ch = j.Events.SubscribeWith(graph.Subscription{
+			Buffer: DefaultBuffer,
+		})
+	}
+
+	// Return success
+	return nil
+}
+
+func (j *Journal) Run(ctx context.Context) error {
+	var result error
+
+	// Replay in the background
+	done := make(chan error, 1)
+	if j.Replay != "" {
+		go func() {
+			done <- j.replay(ctx)
+		}()
+	} else {
+		close(done)
+	}
+
+	// Record states until done, and then record any which are buffered.
+	// Records are written to the file when there are no more buffered
+	for {
+		select {
+		case s := <-j.ch:
+			if err := j.record(s); err != nil {
+				result = multierror.Append(result, err)
+			}
+			if len(j.ch) == 0 {
+				if err := j.flush(); err != nil {
+					result = multierror.Append(result, err)
+				}
+			}
+		case <-ctx.Done():
+			for {
+				select {
+				case s := <-j.ch:
+					if err := j.record(s); err != nil {
+						result = multierror.Append(result, err)
+					}
+				default:
+					if err := j.flush(); err != nil {
+						result = multierror.Append(result, err)
+					}
+					if err := <-done; err != nil && isCancelled(err) == false {
+						result = multierror.Append(result, err)
+					}
+					return result
+				}
+			}
+		}
+	}
+}
+
+func (j *Journal) Dispose() error {
+	var result error
+	if j.ch != nil {
+		j.Events.Unsubscribe(j.ch)
+	}
+	if err := j.flush(); err != nil {
+		result = multierror.Append(result, err)
+	}
+	if j.f != nil {
+		if err := j.f.Close(); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	j.f, j.w, j.ch = nil, nil, nil
+	return result
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (j *Journal) String() string {
+	str := "<journal"
+	if j.Path != "" {
+		str += fmt.Sprintf(" path=%q", j.Path)
+	}
+	if j.Replay != "" {
+		str += fmt.Sprintf(" replay=%q speed=%v", j.Replay, j.Speed)
+	}
+	return str + ">"
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// record writes a state to the journal, except for lifecycle states
+func (j *Journal) record(s graph.State) error {
+	if s == nil || j.w == nil || strings.HasPrefix(s.Name(), lifecyclePrefix) {
+		return nil
+	}
+	if err := j.w.Write(time.Now(), s); err != nil {
+		return fmt.Errorf("%q: %w", s.Name(), err)
+	}
+	return nil
+}
+
+// flush writes buffered records to the journal file
+func (j *Journal) flush() error {
+	if j.w == nil {
+		return nil
+	}
+	return j.w.Flush()
+}
+
+// replay emits states from the replay file
+func (j *Journal) replay(ctx context.Context) error {
+	f, err := os.Open(j.Replay)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Replay(ctx, j.Events, NewReader(f, j.Codec), j.Speed)
+}
+
+// isCancelled returns true if replay ended because the graph stopped
+func isCancelled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, graph.ErrClosed)
+}
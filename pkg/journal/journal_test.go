@@ -0,0 +1,137 @@
+package journal_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	graph "github.com/djthorpe/graph"
+	codec "github.com/djthorpe/graph/pkg/codec"
+	journal "github.com/djthorpe/graph/pkg/journal"
+	tool "github.com/djthorpe/graph/pkg/tool"
+)
+
+/////////////////////////////////////////////////////////////////////
+// STATES
+
+type Reading struct {
+	V int `json:"value"`
+}
+
+func (r *Reading) Name() string       { return "sensor" }
+func (r *Reading) Value() interface{} { return r.V }
+
+func init() {
+	codec.MustRegister("sensor", &Reading{})
+}
+
+/////////////////////////////////////////////////////////////////////
+// UNITS
+
+type Recorder struct {
+	graph.Unit
+	graph.Events
+	Journal *journal.Journal
+}
+
+func (this *Recorder) Run(ctx context.Context) error {
+	for i := 1; i <= 3; i++ {
+		this.Events.Emit(&Reading{i})
+	}
+	return nil
+}
+
+type Player struct {
+	graph.Unit
+	graph.Events
+	Journal *journal.Journal
+
+	ch     <-chan graph.State
+	values []string
+}
+
+func (this *Player) New(graph.State) error {
+	this.ch = this.Events.SubscribeTopic("sensor")
+	return nil
+}
+
+func (this *Player) Run(ctx context.Context) error {
+	defer this.Events.Unsubscribe(this.ch)
+	for len(this.values) < 3 {
+		select {
+		case evt := <-this.ch:
+			if _, ok := evt.(*Reading); ok == false {
+				return fmt.Errorf("unexpected state %T", evt)
+			}
+			this.values = append(this.values, fmt.Sprint(evt.Value()))
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Journal_001(t *testing.T) {
+	// Records are written and read with a codec
+	buf := new(bytes.Buffer)
+	w := journal.NewWriter(buf, journal.JSON{})
+	ts := time.Now()
+	if err := w.Write(ts, &journal.State{N: "a", V: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(ts.Add(time.Second), &journal.State{N: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Truncate the last record
+	buf.Truncate(buf.Len() - 1)
+
+	r := journal.NewReader(buf, journal.JSON{})
+	if ts_, s, err := r.Read(); err != nil {
+		t.Error(err)
+	} else if ts_.Equal(ts) == false || s.Name() != "a" || s.Value() != "b" {
+		t.Error("Unexpected record", ts_, s)
+	}
+	if _, _, err := r.Read(); err != io.EOF {
+		t.Error("Expected EOF, got", err)
+	}
+}
+
+func Test_Journal_002(t *testing.T) {
+	// States are recorded and replayed with their registered types
+	path := filepath.Join(t.TempDir(), "journal")
+	tool.Test(t, []string{"-journal", path}, new(Recorder), func(app *Recorder) {
+		t.Log(app.Journal)
+	})
+	player := new(Player)
+	tool.Test(t, []string{"-journal.replay", path, "-journal.speed", "0"}, player, func(app *Player) {
+		t.Log(app.Journal)
+	})
+	if str := fmt.Sprint(player.values); str != "[1 2 3]" {
+		t.Error("Unexpected values", str)
+	}
+}
+
+func Test_Journal_003(t *testing.T) {
+	// The speed flag defaults to a speed which is already set, or one
+	for speed, expected := range map[float64]float64{0: 1, 2: 2} {
+		j := &journal.Journal{Speed: speed}
+		flags := tool.NewFlagset(t.Name())
+		j.Define(flags)
+		if err := flags.Parse(nil); err != nil {
+			t.Fatal(err)
+		} else if j.Speed != expected {
+			t.Error("Expected speed", expected, "got", j.Speed)
+		}
+	}
+}
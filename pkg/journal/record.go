@@ -0,0 +1,120 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/djthorpe/graph"
+	"github.com/djthorpe/graph/pkg/codec"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Writer appends records to a journal. Each record is the time the
+// state was recorded and the encoded state
+type Writer struct {
+	w     *bufio.Writer
+	codec codec.Codec
+}
+
+// Reader reads records from a journal
+type Reader struct {
+	r     *bufio.Reader
+	codec codec.Codec
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	// headerSize is the size of the time and length of each record
+	headerSize = 12
+
+	// maxRecordSize is the largest encoded state which can be read
+	maxRecordSize = 1 << 24
+)
+
+var (
+	errRecordSize = errors.New("Invalid record size")
+)
+
+/////////////////////////////////////////////////////////////////////
+// NEW
+
+// NewWriter returns a writer which encodes states with a codec
+func NewWriter(w io.Writer, c codec.Codec) *Writer {
+	return &Writer{bufio.NewWriter(w), c}
+}
+
+// NewReader returns a reader which decodes states with a codec
+func NewReader(r io.Reader, c codec.Codec) *Reader {
+	return &Reader{bufio.NewReader(r), c}
+}
+
+/////////////////////////////////////////////////////////////////////
+// WRITER
+
+// Write appends a record for a state, and returns any encoding or
+// write errors. Records are buffered until Flush is called
+func (w *Writer) Write(ts time.Time, s graph.State) error {
+	data, err := w.codec.Marshal(s)
+	if err != nil {
+		return err
+	} else if len(data) > maxRecordSize {
+		return errRecordSize
+	}
+
+	var header [headerSize]byte
+	binary.BigEndian.PutUint64(header[0:], uint64(ts.UnixNano()))
+	binary.BigEndian.PutUint32(header[8:], uint32(len(data)))
+	if _, err := w.w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Flush writes any buffered records
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+/////////////////////////////////////////////////////////////////////
+// READER
+
+// Read returns the next record, or io.EOF when there are no more
+// records. A truncated record at the end of the journal, which may be
+// written when a process ends unexpectedly, is treated as the end
+func (r *Reader) Read() (time.Time, graph.State, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return time.Time{}, nil, io.EOF
+		}
+		return time.Time{}, nil, err
+	}
+	ts := time.Unix(0, int64(binary.BigEndian.Uint64(header[0:])))
+	size := binary.BigEndian.Uint32(header[8:])
+	if size > maxRecordSize {
+		return time.Time{}, nil, errRecordSize
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return time.Time{}, nil, io.EOF
+		}
+		return time.Time{}, nil, err
+	}
+	if s, err := r.codec.Unmarshal(data); err != nil {
+		return time.Time{}, nil, err
+	} else {
+		return ts, s, nil
+	}
+}
@@ -0,0 +1,50 @@
+package journal
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Replay emits the states read from a journal. When speed is one, states
+// are emitted with the original timing, a speed of two emits states twice
+// as fast, and a speed of zero emits states without any delay. It returns
+// when all states have been emitted or the context is done
+func Replay(ctx context.Context, events graph.Events, r *Reader, speed float64) error {
+	var first time.Time
+	start := time.Now()
+	for {
+		ts, s, err := r.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// Wait until the state should be emitted
+		if first.IsZero() {
+			first = ts
+		} else if speed > 0 {
+			at := start.Add(time.Duration(float64(ts.Sub(first)) / speed))
+			if delta := time.Until(at); delta > 0 {
+				timer := time.NewTimer(delta)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				}
+			}
+		}
+
+		// Emit the state
+		if err := events.EmitContext(ctx, s); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	graph "github.com/djthorpe/graph"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Format is the output format for log messages
+type Format int
+
+// entry is a message to be formatted
+type entry struct {
+	time   time.Time
+	level  graph.Level
+	plain  bool // Logged with Print, so the level is not shown in text
+	pc     uintptr
+	caller string
+	msg    string
+	fields []graph.Field
+}
+
+// level is a flag value for a level
+type level graph.Level
+
+// levels is a flag value for the lowest level, and the lowest level
+// for named units as name=level
+type levels struct {
+	level *graph.Level
+	units *map[string]graph.Level
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+const (
+	FormatText   Format = iota // Time, level and message followed by fields
+	FormatJSON                 // One JSON object per line
+	FormatLogfmt               // Key-value pairs
+)
+
+// Keys for the time, level, caller and message
+const (
+	keyTime   = "time"
+	keyLevel  = "level"
+	keyCaller = "caller"
+	keyMsg    = "msg"
+	keyUnit   = "unit"
+)
+
+// keyPrefix is added to the key of a field which is the same as the
+// key for the time, level, caller or message
+const keyPrefix = "field."
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// ParseFormat returns a format from the name "text", "json" or "logfmt"
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	case "logfmt":
+		return FormatLogfmt, nil
+	default:
+		return FormatText, fmt.Errorf("Invalid log format: %q", name)
+	}
+}
+
+// Set parses the format from a flag
+func (f *Format) Set(name string) error {
+	if format, err := ParseFormat(name); err != nil {
+		return err
+	} else {
+		*f = format
+	}
+	return nil
+}
+
+// Set parses the level from a flag
+func (l *level) Set(name string) error {
+	if value, err := graph.ParseLevel(name); err != nil {
+		return err
+	} else {
+		*l = level(value)
+	}
+	return nil
+}
+
+// Set parses a comma-separated list of levels from a flag, where each
+// level is for all units, or for a named unit as name=level
+func (l *levels) Set(value string) error {
+	for _, value := range strings.Split(value, ",") {
+		name, value, named := strings.Cut(strings.TrimSpace(value), "=")
+		if named == false {
+			name, value = "", name
+		}
+		if level, err := graph.ParseLevel(value); err != nil {
+			return err
+		} else if named == false {
+			*l.level = level
+		} else if name == "" {
+			return fmt.Errorf("Invalid log level: %q", "="+value)
+		} else {
+			if *l.units == nil {
+				*l.units = make(map[string]graph.Level)
+			}
+			(*l.units)[name] = level
+		}
+	}
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (f Format) String() string {
+	switch f {
+	case FormatText:
+		return "text"
+	case FormatJSON:
+		return "json"
+	case FormatLogfmt:
+		return "logfmt"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+func (l *level) String() string {
+	return strings.ToLower(graph.Level(*l).String())
+}
+
+func (l *levels) String() string {
+	if l.level == nil {
+		return ""
+	}
+	str := []string{(*level)(l.level).String()}
+	if l.units != nil {
+		for name, value := range *l.units {
+			str = append(str, name+"="+(*level)(&value).String())
+		}
+		sort.Strings(str[1:])
+	}
+	return strings.Join(str, ",")
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// format returns an entry as a line, without a newline
+func (f Format) format(e *entry) string {
+	switch f {
+	case FormatJSON:
+		return formatJSON(e)
+	case FormatLogfmt:
+		return formatLogfmt(e)
+	default:
+		return formatText(e)
+	}
+}
+
+// formatText returns the time, level and message followed by fields
+// and the caller. The level is omitted for messages logged with Print
+func formatText(e *entry) string {
+	var str strings.Builder
+	if e.time.IsZero() == false {
+		str.WriteString(e.time.Format(time.RFC3339) + " ")
+	}
+	if e.plain == false {
+		str.WriteString(e.level.String() + " ")
+	}
+	str.WriteString(e.msg)
+	for _, field := range e.fields {
+		str.WriteString(" " + field.Key + "=" + quote(field.Value))
+	}
+	if e.caller != "" {
+		str.WriteString(" " + keyCaller + "=" + e.caller)
+	}
+	return str.String()
+}
+
+// formatLogfmt returns key-value pairs for the time, level, caller,
+// message and fields. Fields with the same key as the time, level, caller
+// or message are prefixed
+func formatLogfmt(e *entry) string {
+	var str strings.Builder
+	if e.time.IsZero() == false {
+		str.WriteString(keyTime + "=" + e.time.Format(time.RFC3339) + " ")
+	}
+	str.WriteString(keyLevel + "=" + strings.ToLower(e.level.String()))
+	if e.caller != "" {
+		str.WriteString(" " + keyCaller + "=" + e.caller)
+	}
+	str.WriteString(" " + keyMsg + "=" + quote(e.msg))
+	for _, field := range e.fields {
+		str.WriteString(" " + fieldKey(field.Key) + "=" + quote(field.Value))
+	}
+	return str.String()
+}
+
+// formatJSON returns a JSON object with the time, level, caller,
+// message and fields, in that order. Fields with the same key as the
+// time, level, caller or message are prefixed
+func formatJSON(e *entry) string {
+	var str strings.Builder
+	str.WriteString("{")
+	if e.time.IsZero() == false {
+		str.WriteString(strconv.Quote(keyTime) + ":" + strconv.Quote(e.time.Format(time.RFC3339)) + ",")
+	}
+	str.WriteString(strconv.Quote(keyLevel) + ":" + strconv.Quote(strings.ToLower(e.level.String())))
+	if e.caller != "" {
+		str.WriteString("," + strconv.Quote(keyCaller) + ":" + strconv.Quote(e.caller))
+	}
+	str.WriteString("," + strconv.Quote(keyMsg) + ":" + jsonValue(e.msg))
+	for _, field := range e.fields {
+		str.WriteString("," + jsonValue(fieldKey(field.Key)) + ":" + jsonValue(field.Value))
+	}
+	str.WriteString("}")
+	return str.String()
+}
+
+// fieldKey returns the key for a field, prefixed when it is the same as
+// the key for the time, level, caller or message, so that keys are unique
+func fieldKey(key string) string {
+	switch key {
+	case keyTime, keyLevel, keyCaller, keyMsg:
+		return keyPrefix + key
+	default:
+		return key
+	}
+}
+
+// quote returns a value as a string, quoted when it is empty or
+// contains spaces, quotes or equals signs
+func quote(value interface{}) string {
+	str := stringValue(value)
+	if str == "" || strings.ContainsAny(str, " \t\r\n\"=") {
+		return strconv.Quote(str)
+	}
+	return str
+}
+
+// jsonValue returns a value as JSON, or as a JSON string if it cannot
+// be marshalled
+func jsonValue(value interface{}) string {
+	switch value.(type) {
+	case error, time.Duration:
+		value = stringValue(value)
+	}
+	if data, err := json.Marshal(value); err == nil {
+		return string(data)
+	} else {
+		return strconv.Quote(stringValue(value))
+	}
+}
+
+// stringValue returns a value as a string
+func stringValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case error:
+		return value.Error()
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -2,10 +2,18 @@ package log
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	graph "github.com/djthorpe/graph"
 )
@@ -14,16 +22,46 @@ type Log struct {
 	graph.Unit
 	sync.Mutex
 
-	D bool       // D comtains debug flag
-	T *testing.T // T contains testing context
+	D      bool         // D comtains debug flag
+	T      *testing.T   // T contains testing context
+	W      io.Writer    // W is the output, or stderr when nil
+	H      slog.Handler // H is the output handler, instead of W when set
+	Format Format       // Format is the output format
+	Level  graph.Level  // Level is the lowest level which is logged
+
+	// Levels overrides the lowest level logged for named units
+	Levels map[string]graph.Level
+}
+
+// child is a logger which adds fields to every message, and which
+// may be named for a unit
+type child struct {
+	*Log
+	name   string
+	fields []graph.Field
 }
 
+///////////////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+// pkgPrefix is the prefix for functions in this package, which are
+// skipped when finding the caller
+var pkgPrefix = reflect.TypeOf((*Log)(nil)).Elem().PkgPath() + "."
+
 ///////////////////////////////////////////////////////////////////////////////
 // LIFECYCLE
 
-func (*Log) New(graph.State) error {
-	log.SetFlags(log.Ltime)
-	return nil
+func (this *Log) Define(state graph.State) {
+	if flags, ok := state.Value().(*flag.FlagSet); ok {
+		flags.Var(&this.Format, "log.format", "Log format (text, json or logfmt)")
+		flags.Var(&levels{&this.Level, &this.Levels}, "log.level", "Lowest level logged (debug, info, warn or error), or for a unit as name=level")
+	}
+}
+
+// NewLogger returns a logger which writes to a slog handler, and logs
+// at the levels enabled by the handler
+func NewLogger(h slog.Handler) *Log {
+	return &Log{H: h, Level: graph.LevelDebug}
 }
 
 func (this *Log) Run(ctx context.Context) error {
@@ -37,29 +75,27 @@ func (this *Log) Run(ctx context.Context) error {
 // PUBLIC METHODS
 
 func (this *Log) Print(args ...interface{}) {
-	this.Lock()
-	defer this.Unlock()
-	if this.T != nil {
-		this.T.Log(args...)
-	} else {
-		log.Print(args...)
-	}
+	this.print(fmt.Sprint(args...), nil)
 }
 
 func (this *Log) Debug(args ...interface{}) {
-	if this.IsDebug() {
-		this.Print(args...)
-	}
+	this.level("", graph.LevelDebug, nil, args)
 }
 
-func (this *Log) Printf(fmt string, args ...interface{}) {
-	this.Lock()
-	defer this.Unlock()
-	if this.T != nil {
-		this.T.Logf(fmt, args...)
-	} else {
-		log.Printf(fmt, args...)
-	}
+func (this *Log) Info(args ...interface{}) {
+	this.level("", graph.LevelInfo, nil, args)
+}
+
+func (this *Log) Warn(args ...interface{}) {
+	this.level("", graph.LevelWarn, nil, args)
+}
+
+func (this *Log) Error(args ...interface{}) {
+	this.level("", graph.LevelError, nil, args)
+}
+
+func (this *Log) Printf(format string, args ...interface{}) {
+	this.print(fmt.Sprintf(format, args...), nil)
 }
 
 func (this *Log) Debugf(fmt string, args ...interface{}) {
@@ -68,8 +104,19 @@ func (this *Log) Debugf(fmt string, args ...interface{}) {
 	}
 }
 
+// With returns a logger which adds fields to every message
+func (this *Log) With(fields ...graph.Field) graph.Logger {
+	return &child{this, "", fields}
+}
+
+// Named returns a logger for a unit, which logs the name of the unit
+// and the lowest level set for the unit
+func (this *Log) Named(name string) graph.Logger {
+	return &child{this, name, []graph.Field{graph.F(keyUnit, name)}}
+}
+
 func (this *Log) IsDebug() bool {
-	return this.D
+	return this.enabled("", graph.LevelDebug)
 }
 
 func (this *Log) Test() *testing.T {
@@ -81,6 +128,47 @@ func (this *Log) SetTest(t *testing.T) {
 	this.T = t
 }
 
+///////////////////////////////////////////////////////////////////////////////
+// CHILD METHODS
+
+func (this *child) Print(args ...interface{}) {
+	this.Log.print(fmt.Sprint(args...), this.fields)
+}
+
+func (this *child) Printf(format string, args ...interface{}) {
+	this.Log.print(fmt.Sprintf(format, args...), this.fields)
+}
+
+func (this *child) Debugf(format string, args ...interface{}) {
+	if this.IsDebug() {
+		this.Printf(format, args...)
+	}
+}
+
+func (this *child) Debug(args ...interface{}) {
+	this.Log.level(this.name, graph.LevelDebug, this.fields, args)
+}
+
+func (this *child) Info(args ...interface{}) {
+	this.Log.level(this.name, graph.LevelInfo, this.fields, args)
+}
+
+func (this *child) Warn(args ...interface{}) {
+	this.Log.level(this.name, graph.LevelWarn, this.fields, args)
+}
+
+func (this *child) Error(args ...interface{}) {
+	this.Log.level(this.name, graph.LevelError, this.fields, args)
+}
+
+func (this *child) With(fields ...graph.Field) graph.Logger {
+	return &child{this.Log, this.name, append(append([]graph.Field(nil), this.fields...), fields...)}
+}
+
+func (this *child) IsDebug() bool {
+	return this.Log.enabled(this.name, graph.LevelDebug)
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // STRINGIFY
 
@@ -88,11 +176,113 @@ func (this *Log) String() string {
 	str := "<log"
 	if this == nil {
 		str += " nil"
-	} else if debug := this.IsDebug(); debug {
-		str += fmt.Sprint(" debug")
+	} else {
+		str += fmt.Sprint(" format=", this.Format)
+		if debug := this.IsDebug(); debug {
+			str += fmt.Sprint(" debug")
+		} else {
+			str += fmt.Sprint(" level=", (*level)(&this.Level))
+		}
 		if t := this.Test(); t != nil {
 			str += fmt.Sprintf(" test=%q", t.Name())
 		}
 	}
 	return str + ">"
 }
+
+func (this *child) String() string {
+	str := "<log"
+	if this.name != "" {
+		str += fmt.Sprintf(" name=%q", this.name)
+	}
+	if len(this.fields) > 0 {
+		str += fmt.Sprint(" fields=", this.fields)
+	}
+	return str + ">"
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// level writes a message at a level for a named unit, with the fields
+// from a child logger followed by any fields in the arguments
+func (this *Log) level(name string, level graph.Level, fields []graph.Field, args []interface{}) {
+	if this.enabled(name, level) == false {
+		return
+	}
+	msg, other := graph.SplitFields(args)
+	if len(other) > 0 {
+		fields = append(append([]graph.Field(nil), fields...), other...)
+	}
+	pc, caller := caller()
+	this.write(&entry{level: level, pc: pc, caller: caller, msg: msg, fields: fields})
+}
+
+// print writes a message without a level, which is logged at info
+// level in formats which require a level
+func (this *Log) print(msg string, fields []graph.Field) {
+	pc, caller := caller()
+	this.write(&entry{level: graph.LevelInfo, plain: true, pc: pc, caller: caller, msg: strings.TrimSuffix(msg, "\n"), fields: fields})
+}
+
+// enabled returns true if messages at a level are logged for a named
+// unit. Debug messages are always logged when the debug flag is set, and
+// otherwise the level must also be enabled by any output handler
+func (this *Log) enabled(name string, level graph.Level) bool {
+	if level == graph.LevelDebug && this.D {
+		return true
+	} else if this.H != nil && this.H.Enabled(context.Background(), slogLevel(level)) == false {
+		return false
+	} else if min, exists := this.Levels[name]; exists && name != "" {
+		return level >= min
+	} else {
+		return level >= this.Level
+	}
+}
+
+// write formats an entry with the time, and writes it to the test
+// context, the output handler or the output. The output handler is
+// called without holding the lock, so that it can log to this logger
+func (this *Log) write(e *entry) {
+	if e.time.IsZero() {
+		e.time = time.Now()
+	}
+
+	this.Lock()
+	if h := this.H; this.T == nil && h != nil {
+		this.Unlock()
+		h.Handle(context.Background(), e.record())
+		return
+	}
+	defer this.Unlock()
+	if this.T != nil {
+		this.T.Log(this.Format.format(e))
+	} else if this.W != nil {
+		fmt.Fprintln(this.W, this.Format.format(e))
+	} else {
+		fmt.Fprintln(os.Stderr, this.Format.format(e))
+	}
+}
+
+// caller returns the program counter, file and line which called the
+// logger, outside of this package. When the logger is called by the graph,
+// such as from its own Run method, the caller within this package is returned.
+// The program counter is a return address, as returned by runtime.Callers
+func caller() (uintptr, string) {
+	pc := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(2, pc)])
+	var last runtime.Frame
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, pkgPrefix) == false {
+			if strings.HasPrefix(frame.Function, "reflect.") || strings.HasPrefix(frame.Function, "runtime.") {
+				frame = last
+			}
+			return frame.PC + 1, fmt.Sprint(filepath.Base(frame.File), ":", frame.Line)
+		}
+		if more == false {
+			return 0, ""
+		}
+		last = frame
+	}
+}
@@ -0,0 +1,242 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	graph "github.com/djthorpe/graph"
+	pkg "github.com/djthorpe/graph/pkg/graph"
+	log "github.com/djthorpe/graph/pkg/log"
+	tool "github.com/djthorpe/graph/pkg/tool"
+)
+
+func Test_Log_001(t *testing.T) {
+	// Levelled methods log the message and fields, and child loggers
+	// add their fields to every message
+	buf := new(bytes.Buffer)
+	logger := &log.Log{W: buf}
+	logger.Info("connected", graph.F("addr", "localhost:80"))
+	logger.Debug("not logged")
+	child := logger.With(graph.F("unit", "store"))
+	child.Warn("slow", graph.F("took", "1.5s"), graph.F("reason", "disk full"))
+	child.With(graph.F("id", 1)).Error("failed")
+	child.Print("plain")
+
+	expected := []string{
+		`^\S+ INFO connected addr=localhost:80 caller=log_test.go:\d+$`,
+		`^\S+ WARN slow unit=store took=1.5s reason="disk full" caller=log_test.go:\d+$`,
+		`^\S+ ERROR failed unit=store id=1 caller=log_test.go:\d+$`,
+		`^\S+ plain unit=store caller=log_test.go:\d+$`,
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Unexpected output:\n%v", buf.String())
+	}
+	for i, line := range lines {
+		if regexp.MustCompile(expected[i]).MatchString(line) == false {
+			t.Errorf("Unexpected line: %q", line)
+		}
+	}
+}
+
+func Test_Log_002(t *testing.T) {
+	// JSON format has the time, level, caller, message and fields
+	buf := new(bytes.Buffer)
+	logger := &log.Log{W: buf, Format: log.FormatJSON}
+	logger.With(graph.F("unit", "store")).Warn("slow", graph.F("count", 3))
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range map[string]interface{}{"level": "warn", "msg": "slow", "unit": "store", "count": 3.0} {
+		if line[key] != value {
+			t.Error("Unexpected", key, line[key])
+		}
+	}
+	if regexp.MustCompile(`^log_test.go:\d+$`).MatchString(line["caller"].(string)) == false {
+		t.Error("Unexpected caller", line["caller"])
+	}
+	if regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d`).MatchString(line["time"].(string)) == false {
+		t.Error("Unexpected time", line["time"])
+	}
+}
+
+func Test_Log_003(t *testing.T) {
+	// Format and level are set from flags, and messages below the level
+	// are not logged
+	buf := new(bytes.Buffer)
+	logger := &log.Log{W: buf}
+	flags := tool.NewFlagset(t.Name())
+	flags.SetOutput(io.Discard)
+	logger.Define(flags)
+	if err := flags.Parse([]string{"-log.format", "logfmt", "-log.level", "warn"}); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("not logged")
+	logger.Error("failed", graph.F("err", "disk full"))
+	if regexp.MustCompile(`^time=\S+ level=error caller=log_test.go:\d+ msg=failed err="disk full"\n$`).MatchString(buf.String()) == false {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+	if err := flags.Parse([]string{"-log.format", "xml"}); err == nil {
+		t.Error("Expected error for invalid format")
+	}
+}
+
+type store struct {
+	graph.Unit
+	graph.Logger
+}
+
+func Test_Log_004(t *testing.T) {
+	// Units are injected with a logger named for the unit, and the
+	// level for a unit is set from flags
+	unit := new(store)
+	g := pkg.New(unit)
+	if g == nil {
+		t.Fatal("New() failed")
+	}
+	buf := new(bytes.Buffer)
+	logger := g.(*pkg.Graph).Logger().(*log.Log)
+	logger.W = buf
+
+	flags := tool.NewFlagset(t.Name())
+	flags.SetOutput(io.Discard)
+	g.Define(flags)
+	if err := flags.Parse([]string{"-log.level", "warn,log_test.store=debug"}); err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("not logged")
+	unit.Debug("opened", graph.F("records", 42))
+	if unit.IsDebug() == false || logger.IsDebug() {
+		t.Error("Unexpected debug for unit or logger")
+	}
+	if regexp.MustCompile(`^\S+ DEBUG opened unit=log_test.store records=42 caller=log_test.go:\d+\n$`).MatchString(buf.String()) == false {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+	if err := flags.Parse([]string{"-log.level", "=debug"}); err == nil {
+		t.Error("Expected error for missing unit name")
+	}
+}
+
+func Test_Log_005(t *testing.T) {
+	// Records logged with slog are written by the logger, and a logger
+	// can write to a slog handler
+	buf := new(bytes.Buffer)
+	logger := &log.Log{W: buf}
+	slogger := slog.New(log.NewHandler(logger)).With("addr", "localhost:80").WithGroup("req")
+	slogger.Debug("not logged")
+	slogger.Warn("slow", "took", 2, slog.Group("disk", "free", 0))
+	if regexp.MustCompile(`^\S+ WARN slow addr=localhost:80 req.took=2 req.disk.free=0 caller=log_test.go:\d+\n$`).MatchString(buf.String()) == false {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+
+	buf.Reset()
+	logger = log.NewLogger(slog.NewJSONHandler(buf, &slog.HandlerOptions{AddSource: true}))
+	logger.Debug("not logged")
+	logger.With(graph.F("unit", "store")).Info("opened", graph.F("records", 42))
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatal(err, buf.String())
+	}
+	for key, value := range map[string]interface{}{"level": "INFO", "msg": "opened", "unit": "store", "records": 42.0} {
+		if line[key] != value {
+			t.Error("Unexpected", key, line[key])
+		}
+	}
+	if source, ok := line["source"].(map[string]interface{}); ok == false || strings.HasSuffix(source["file"].(string), "log_test.go") == false {
+		t.Error("Unexpected source", line["source"])
+	}
+	if logger.IsDebug() {
+		t.Error("Unexpected debug")
+	}
+}
+
+func Test_Log_006(t *testing.T) {
+	// The logger is the default for slog until it is restored
+	buf := new(bytes.Buffer)
+	restore := log.SetDefault(&log.Log{W: buf})
+	slog.Info("routed", "count", 1)
+	restore()
+	if _, ok := slog.Default().Handler().(*log.Handler); ok {
+		t.Error("Unexpected default handler after restore")
+	}
+	if regexp.MustCompile(`^\S+ INFO routed count=1 caller=log_test.go:\d+\n$`).MatchString(buf.String()) == false {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+}
+
+// reentrant is a slog handler which logs to a logger when it handles
+// a record
+type reentrant struct {
+	logger *log.Log
+	msgs   chan string
+}
+
+func (h *reentrant) Enabled(context.Context, slog.Level) bool { return true }
+func (h *reentrant) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *reentrant) WithGroup(string) slog.Handler            { return h }
+
+func (h *reentrant) Handle(ctx context.Context, r slog.Record) error {
+	h.msgs <- r.Message
+	if r.Message == "outer" {
+		h.logger.Info("inner")
+	}
+	return nil
+}
+
+func Test_Log_007(t *testing.T) {
+	// A handler can log to the logger which called it
+	h := &reentrant{msgs: make(chan string, 2)}
+	h.logger = log.NewLogger(h)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.logger.Info("outer")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Timeout logging from handler")
+	}
+	for _, expected := range []string{"outer", "inner"} {
+		if msg := <-h.msgs; msg != expected {
+			t.Error("Expected", expected, "got", msg)
+		}
+	}
+}
+
+func Test_Log_008(t *testing.T) {
+	// Fields with the same key as the time, level, caller or message are
+	// prefixed
+	for _, format := range []log.Format{log.FormatJSON, log.FormatLogfmt} {
+		buf := new(bytes.Buffer)
+		logger := &log.Log{W: buf, Format: format}
+		logger.Info("opened", graph.F("msg", "other"), graph.F("level", 1), graph.F("time", "now"), graph.F("caller", "me"))
+		if format == log.FormatJSON {
+			dec := json.NewDecoder(bytes.NewReader(buf.Bytes()))
+			dec.UseNumber()
+			var line map[string]interface{}
+			if err := dec.Decode(&line); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range map[string]interface{}{"msg": "opened", "level": "info", "field.msg": "other", "field.level": json.Number("1"), "field.time": "now", "field.caller": "me"} {
+				if line[key] != value {
+					t.Error("Unexpected", key, line[key])
+				}
+			}
+			if n := strings.Count(buf.String(), `"msg":`); n != 1 {
+				t.Error("Unexpected msg keys", buf.String())
+			}
+		} else if regexp.MustCompile(`^time=\S+ level=info caller=log_test.go:\d+ msg=opened field.msg=other field.level=1 field.time=now field.caller=me\n$`).MatchString(buf.String()) == false {
+			t.Errorf("Unexpected output: %q", buf.String())
+		}
+	}
+}
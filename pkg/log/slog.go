@@ -0,0 +1,188 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+
+	graph "github.com/djthorpe/graph"
+)
+
+///////////////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Handler is a slog handler which writes records to a graph logger, so
+// that packages which log with slog use the format, levels and test
+// context of the logger
+type Handler struct {
+	logger graph.Logger
+	fields []graph.Field
+	group  string // Prefix for keys
+}
+
+// Ensure Handler implements slog.Handler
+var _ slog.Handler = (*Handler)(nil)
+
+///////////////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+// NewHandler returns a slog handler which writes records to a logger
+func NewHandler(logger graph.Logger) *Handler {
+	return &Handler{logger: logger}
+}
+
+// SetDefault makes a logger the default for slog and the standard log
+// package, and returns a function which restores the previous default.
+// It is not called by the graph, so packages which log with slog are only
+// routed through a logger once it is called
+func SetDefault(logger graph.Logger) func() {
+	prev, w, flags := slog.Default(), log.Writer(), log.Flags()
+	slog.SetDefault(slog.New(NewHandler(logger)))
+	return func() {
+		slog.SetDefault(prev)
+		log.SetOutput(w)
+		log.SetFlags(flags)
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Enabled returns true if the logger logs messages at a level
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	switch logger := h.logger.(type) {
+	case *Log:
+		return logger.enabled("", graphLevel(level))
+	case *child:
+		return logger.Log.enabled(logger.name, graphLevel(level))
+	default:
+		return level >= slog.LevelInfo || logger.IsDebug()
+	}
+}
+
+// Handle writes a record to the logger, with the caller of the record.
+// Loggers which are not from this package are called with the message
+// and fields at the level of the record
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	fields := h.fields
+	r.Attrs(func(attr slog.Attr) bool {
+		fields = appendAttr(fields, h.group, attr)
+		return true
+	})
+	switch logger := h.logger.(type) {
+	case *Log:
+		logger.handle("", fields, r)
+	case *child:
+		logger.Log.handle(logger.name, append(append([]graph.Field(nil), logger.fields...), fields...), r)
+	default:
+		args := []interface{}{r.Message}
+		for _, field := range fields {
+			args = append(args, field)
+		}
+		switch graphLevel(r.Level) {
+		case graph.LevelDebug:
+			logger.Debug(args...)
+		case graph.LevelInfo:
+			logger.Info(args...)
+		case graph.LevelWarn:
+			logger.Warn(args...)
+		default:
+			logger.Error(args...)
+		}
+	}
+	return nil
+}
+
+// WithAttrs returns a handler which adds attributes to every record
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := append([]graph.Field(nil), h.fields...)
+	for _, attr := range attrs {
+		fields = appendAttr(fields, h.group, attr)
+	}
+	return &Handler{h.logger, fields, h.group}
+}
+
+// WithGroup returns a handler which prefixes the keys of attributes
+// with the group name
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &Handler{h.logger, h.fields, h.group + name + "."}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// handle writes a record for a named unit, with the fields from a child
+// logger and the attributes of the record
+func (this *Log) handle(name string, fields []graph.Field, r slog.Record) {
+	level := graphLevel(r.Level)
+	if this.enabled(name, level) == false {
+		return
+	}
+	var caller string
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		caller = fmt.Sprint(filepath.Base(frame.File), ":", frame.Line)
+	}
+	this.write(&entry{time: r.Time, level: level, pc: r.PC, caller: caller, msg: r.Message, fields: fields})
+}
+
+// record returns an entry as a slog record
+func (e *entry) record() slog.Record {
+	r := slog.NewRecord(e.time, slogLevel(e.level), e.msg, e.pc)
+	for _, field := range e.fields {
+		r.AddAttrs(slog.Any(field.Key, field.Value))
+	}
+	return r
+}
+
+// appendAttr appends an attribute as a field with the group prefix,
+// and the attributes within a group with the group name as a prefix
+func appendAttr(fields []graph.Field, group string, attr slog.Attr) []graph.Field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	} else if attr.Value.Kind() != slog.KindGroup {
+		return append(fields, graph.F(group+attr.Key, attr.Value.Any()))
+	}
+	if attr.Key != "" {
+		group += attr.Key + "."
+	}
+	for _, attr := range attr.Value.Group() {
+		fields = appendAttr(fields, group, attr)
+	}
+	return fields
+}
+
+// graphLevel returns the level for a slog level
+func graphLevel(level slog.Level) graph.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return graph.LevelDebug
+	case level < slog.LevelWarn:
+		return graph.LevelInfo
+	case level < slog.LevelError:
+		return graph.LevelWarn
+	default:
+		return graph.LevelError
+	}
+}
+
+// slogLevel returns the slog level for a level
+func slogLevel(level graph.Level) slog.Level {
+	switch level {
+	case graph.LevelDebug:
+		return slog.LevelDebug
+	case graph.LevelInfo:
+		return slog.LevelInfo
+	case graph.LevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
@@ -0,0 +1,234 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Cron is a parsed cron expression with five fields: minute, hour,
+// day of month, month and day of week. Each field is a "*", a value,
+// a range "a-b", a list "a,b" or any of these with a step "/n"
+type Cron struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64 // Bitsets of matching values
+	anyDom, anyDow                bool   // True when the field is "*"
+}
+
+// field is the range of values for a cron field
+type field struct {
+	min, max int
+	names    []string // Names for values, starting at min
+}
+
+/////////////////////////////////////////////////////////////////////
+// GLOBALS
+
+var (
+	// ErrBadCron is returned when a cron expression cannot be parsed
+	ErrBadCron = errors.New("Bad cron expression")
+)
+
+var (
+	minutes = field{0, 59, nil}
+	hours   = field{0, 23, nil}
+	doms    = field{1, 31, nil}
+	months  = field{1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dows    = field{0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// descriptors are shorthand for common expressions
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxYears is how far ahead Next searches for a matching time, so
+// that expressions such as "0 0 30 2 *" which never match end
+const maxYears = 5
+
+/////////////////////////////////////////////////////////////////////
+// NEW
+
+// ParseCron returns a cron expression such as "*/5 * * * *" or one of
+// the descriptors @hourly, @daily, @weekly, @monthly or @yearly
+func ParseCron(expr string) (*Cron, error) {
+	c := &Cron{expr: expr}
+	if d, exists := descriptors[strings.ToLower(expr)]; exists {
+		expr = d
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: %q", ErrBadCron, c.expr)
+	}
+	var err error
+	if c.minute, err = minutes.parse(fields[0]); err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrBadCron, c.expr, err)
+	}
+	if c.hour, err = hours.parse(fields[1]); err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrBadCron, c.expr, err)
+	}
+	if c.dom, err = doms.parse(fields[2]); err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrBadCron, c.expr, err)
+	}
+	if c.month, err = months.parse(fields[3]); err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrBadCron, c.expr, err)
+	}
+	if c.dow, err = dows.parse(fields[4]); err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrBadCron, c.expr, err)
+	} else if has(c.dow, 7) {
+		// Sunday is either 0 or 7
+		c.dow |= 1
+	}
+	c.anyDom, c.anyDow = fields[2] == "*", fields[4] == "*"
+
+	// Return success
+	return c, nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Next returns the first time after t which matches the expression,
+// in the location of t, or the zero time if there is no such time.
+// Times are matched on the wall clock, so a time which is skipped
+// when daylight saving starts does not match, and a time which is
+// repeated when it ends matches once
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(maxYears, 0, 0)
+	for t.Before(end) {
+		switch {
+		case has(c.month, int(t.Month())) == false:
+			t = date(t.Year(), t.Month()+1, 1, 0, t.Location())
+		case c.day(t) == false:
+			t = date(t.Year(), t.Month(), t.Day()+1, 0, t.Location())
+		case has(c.hour, t.Hour()) == false:
+			t = date(t.Year(), t.Month(), t.Day(), t.Hour()+1, t.Location())
+		case has(c.minute, t.Minute()) == false || repeated(t):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (c *Cron) String() string {
+	return fmt.Sprintf("<cron %q>", c.expr)
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// day returns true if the day of t matches. When both the day of month
+// and day of week are restricted, either can match
+func (c *Cron) day(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	if c.anyDom || c.anyDow {
+		return dom && dow
+	} else {
+		return dom || dow
+	}
+}
+
+// date returns the start of an hour on the wall clock. When the hour is
+// skipped as daylight saving starts, the time after the clocks have
+// moved forward is returned, rather than the time before
+func date(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	want := time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+	if t.Day() == want.Day() && t.Hour() == want.Hour() {
+		return t
+	}
+	_, before := t.Zone()
+	_, after := t.Add(24 * time.Hour).Zone()
+	return t.Add(time.Duration(after-before) * time.Second)
+}
+
+// repeated returns true if the wall clock time of t has already
+// occurred earlier, as the clocks moved back when daylight saving ended
+func repeated(t time.Time) bool {
+	_, now := t.Zone()
+	_, before := t.Add(-24 * time.Hour).Zone()
+	if before <= now {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-now) * time.Second)
+	return earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute()
+}
+
+// parse returns a bitset of values for a comma-separated field
+func (f field) parse(str string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(str, ",") {
+		// Parse the step
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			if n, err := strconv.Atoi(part[i+1:]); err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q", part)
+			} else {
+				step, part = n, part[:i]
+			}
+		}
+
+		// Parse the range
+		min, max := f.min, f.max
+		if part != "*" {
+			var err error
+			if i := strings.Index(part, "-"); i >= 0 {
+				if min, err = f.value(part[:i]); err != nil {
+					return 0, err
+				}
+				if max, err = f.value(part[i+1:]); err != nil {
+					return 0, err
+				}
+			} else if min, err = f.value(part); err != nil {
+				return 0, err
+			} else if step > 1 {
+				max = f.max
+			} else {
+				max = min
+			}
+		}
+		if min > max {
+			return 0, fmt.Errorf("bad range %q", part)
+		}
+		for i := min; i <= max; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+// value returns a number or name within the range of the field
+func (f field) value(str string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(str, name) {
+			return f.min + i, nil
+		}
+	}
+	if n, err := strconv.Atoi(str); err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("bad value %q", str)
+	} else {
+		return n, nil
+	}
+}
+
+// has returns true if a value is in a bitset
+func has(bits uint64, i int) bool {
+	return bits&(1<<uint(i)) != 0
+}
@@ -0,0 +1,110 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/djthorpe/graph"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Job is a state scheduled for emission, which can be cancelled
+type Job struct {
+	s     *Scheduler
+	state graph.State
+	next  time.Time
+	every time.Duration // Interval for repeating jobs
+	cron  *Cron         // Expression for cron jobs
+	index int           // Index in the queue, or -1 when not scheduled
+}
+
+// queue is a heap of jobs, with the next job first
+type queue []*Job
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Cancel removes the job from the schedule, and returns false if the
+// job had already been emitted or cancelled
+func (j *Job) Cancel() bool {
+	return j.s.cancel(j)
+}
+
+// Next returns the time the job is next emitted, or the zero time
+// if the job is no longer scheduled
+func (j *Job) Next() time.Time {
+	j.s.Mutex.Lock()
+	defer j.s.Mutex.Unlock()
+	if j.index < 0 {
+		return time.Time{}
+	} else {
+		return j.next
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (j *Job) String() string {
+	str := "<job"
+	if j.state != nil {
+		str += fmt.Sprintf(" state=%q", j.state.Name())
+	}
+	if next := j.Next(); next.IsZero() == false {
+		str += fmt.Sprintf(" next=%v", next.Format(time.RFC3339))
+	}
+	if j.every > 0 {
+		str += fmt.Sprintf(" every=%v", j.every)
+	}
+	if j.cron != nil {
+		str += fmt.Sprintf(" cron=%q", j.cron.expr)
+	}
+	return str + ">"
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// reschedule sets the next time for a repeating job after it has been
+// emitted at t, and returns false if the job does not repeat
+func (j *Job) reschedule(t time.Time) bool {
+	switch {
+	case j.every > 0:
+		// Skip intervals which were missed
+		for j.next = j.next.Add(j.every); j.next.After(t) == false; j.next = j.next.Add(j.every) {
+		}
+		return true
+	case j.cron != nil:
+		j.next = j.cron.Next(t)
+		return j.next.IsZero() == false
+	default:
+		return false
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// HEAP
+
+func (q queue) Len() int           { return len(q) }
+func (q queue) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *queue) Push(x interface{}) {
+	j := x.(*Job)
+	j.index = len(*q)
+	*q = append(*q, j)
+}
+
+func (q *queue) Pop() interface{} {
+	old := *q
+	j := old[len(old)-1]
+	old[len(old)-1] = nil
+	j.index = -1
+	*q = old[:len(old)-1]
+	return j
+}
@@ -0,0 +1,171 @@
+package schedule_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	graph "github.com/djthorpe/graph"
+	schedule "github.com/djthorpe/graph/pkg/schedule"
+	tool "github.com/djthorpe/graph/pkg/tool"
+)
+
+/////////////////////////////////////////////////////////////////////
+// STATES AND UNITS
+
+type tick string
+
+func (t tick) Name() string       { return string(t) }
+func (t tick) Value() interface{} { return nil }
+
+type App struct {
+	graph.Unit
+	graph.Events
+	Scheduler *schedule.Scheduler
+
+	ch    <-chan graph.State
+	names []string
+}
+
+func (this *App) New(graph.State) error {
+	this.ch = this.Events.SubscribeTopic("once", "every", "cancelled")
+	return nil
+}
+
+func (this *App) Run(ctx context.Context) error {
+	defer this.Events.Unsubscribe(this.ch)
+
+	this.Scheduler.After(20*time.Millisecond, tick("once"))
+	this.Scheduler.After(10*time.Millisecond, tick("cancelled")).Cancel()
+	every := this.Scheduler.Every(time.Millisecond, tick("every"))
+	for {
+		select {
+		case evt := <-this.ch:
+			this.names = append(this.names, evt.Name())
+			if evt.Name() == "once" {
+				every.Cancel()
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// TESTS
+
+func Test_Schedule_001(t *testing.T) {
+	// Cron expressions return the next matching time
+	from := time.Date(2021, time.January, 1, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.January, 1, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.January, 1, 10, 45, 0, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2021, time.January, 1, 11, 0, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2021, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 feb *", time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		if c, err := schedule.ParseCron(test.expr); err != nil {
+			t.Error(test.expr, err)
+		} else if next := c.Next(from); next.Equal(test.next) == false {
+			t.Error(test.expr, "unexpected next time", next)
+		}
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "* * * bad *"} {
+		if _, err := schedule.ParseCron(expr); errors.Is(err, schedule.ErrBadCron) == false {
+			t.Error(expr, "expected ErrBadCron, got", err)
+		}
+	}
+}
+
+func Test_Schedule_002(t *testing.T) {
+	// States are emitted at an interval and after a delay, and
+	// cancelled jobs are not emitted
+	app := new(App)
+	tool.Test(t, nil, app, func(app *App) {
+		t.Log(app.Scheduler)
+	})
+	if len(app.names) < 2 {
+		t.Fatal("Expected at least two states, got", app.names)
+	}
+	for i, name := range app.names {
+		switch {
+		case name == "cancelled":
+			t.Error("Unexpected cancelled state")
+		case i < len(app.names)-1 && name != "every":
+			t.Error("Unexpected state", name)
+		case i == len(app.names)-1 && name != "once":
+			t.Error("Unexpected last state", name)
+		}
+	}
+	if jobs := app.Scheduler.Jobs(); len(jobs) != 0 {
+		t.Error("Unexpected jobs", jobs)
+	}
+}
+
+func Test_Schedule_003(t *testing.T) {
+	// Cron expressions match the wall clock in zones which are not a
+	// whole number of hours from UTC, and across daylight saving
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip(err)
+	}
+	newyork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	havana, err := time.LoadLocation("America/Havana")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		expr       string
+		from, next time.Time
+	}{
+		{"0 9 * * *", time.Date(2021, time.January, 1, 10, 30, 0, 0, kolkata), time.Date(2021, time.January, 2, 9, 0, 0, 0, kolkata)},
+		{"@daily", time.Date(2021, time.January, 1, 10, 30, 0, 0, kolkata), time.Date(2021, time.January, 2, 0, 0, 0, 0, kolkata)},
+		{"@hourly", time.Date(2021, time.January, 1, 10, 30, 0, 0, kolkata), time.Date(2021, time.January, 1, 11, 0, 0, 0, kolkata)},
+		{"30 2 * * *", time.Date(2021, time.March, 14, 0, 0, 0, 0, newyork), time.Date(2021, time.March, 15, 2, 30, 0, 0, newyork)},
+		{"0 3 * * *", time.Date(2021, time.March, 14, 0, 0, 0, 0, newyork), time.Date(2021, time.March, 14, 3, 0, 0, 0, newyork)},
+		{"0 2 * * *", time.Date(2021, time.November, 7, 0, 0, 0, 0, newyork), time.Date(2021, time.November, 7, 2, 0, 0, 0, newyork)},
+		{"@daily", time.Date(2021, time.March, 13, 12, 0, 0, 0, havana), time.Date(2021, time.March, 15, 0, 0, 0, 0, havana)},
+		{"0 1 * * *", time.Date(2021, time.March, 13, 12, 0, 0, 0, havana), time.Date(2021, time.March, 14, 1, 0, 0, 0, havana)},
+	}
+	for _, test := range tests {
+		if c, err := schedule.ParseCron(test.expr); err != nil {
+			t.Error(test.expr, err)
+		} else if next := c.Next(test.from); next.Equal(test.next) == false {
+			t.Error(test.expr, "unexpected next time", next)
+		}
+	}
+}
+
+func Test_Schedule_004(t *testing.T) {
+	// A time which is repeated when daylight saving ends matches once
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip(err)
+	}
+	c, err := schedule.ParseCron("*/30 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := time.Date(2026, time.October, 25, 0, 45, 0, 0, london)
+	var times []string
+	for i := 0; i < 4; i++ {
+		next = c.Next(next)
+		times = append(times, next.Format("15:04 MST"))
+	}
+	if str := strings.Join(times, ","); str != "01:00 BST,01:30 BST,02:00 GMT,02:30 GMT" {
+		t.Error("Unexpected times", str)
+	}
+}
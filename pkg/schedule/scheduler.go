@@ -0,0 +1,210 @@
+package schedule
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/djthorpe/graph"
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// Scheduler emits states on the events unit after a delay, at a fixed
+// interval or on a cron expression. States are emitted whilst the
+// scheduler is running, and those which become due whilst it is not
+// running are emitted when it next runs
+type Scheduler struct {
+	graph.Unit
+	graph.Events
+	sync.Mutex
+
+	jobs queue
+	wake chan struct{} // Signalled when the next job changes
+}
+
+/////////////////////////////////////////////////////////////////////
+// LIFECYCLE
+
+func (s *Scheduler) New(graph.State) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if s.wake == nil {
+		s.wake = make(chan struct{}, 1)
+	}
+	return nil
+}
+
+func (s *Scheduler) Run(ctx context.Context) error {
+	var result error
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		// Emit jobs which are due, and wait until the next job
+		for _, j := range s.due(time.Now()) {
+			// Errors when the graph stops are ignored
+			err := s.Events.EmitContext(ctx, j.state)
+			if err != nil && errors.Is(err, context.Canceled) == false && errors.Is(err, graph.ErrClosed) == false {
+				result = multierror.Append(result, fmt.Errorf("%q: %w", j.state.Name(), err))
+			}
+		}
+		if timer.Stop() == false {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if d, ok := s.wait(time.Now()); ok {
+			timer.Reset(d)
+		}
+		select {
+		case <-ctx.Done():
+			return result
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Scheduler) Dispose() error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	for _, j := range s.jobs {
+		j.index = -1
+	}
+	s.jobs = nil
+	return nil
+}
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// After emits a state once, after a delay
+func (s *Scheduler) After(d time.Duration, state graph.State) *Job {
+	return s.schedule(&Job{state: state, next: time.Now().Add(d)})
+}
+
+// At emits a state once, at a time
+func (s *Scheduler) At(t time.Time, state graph.State) *Job {
+	return s.schedule(&Job{state: state, next: t})
+}
+
+// Every emits a state repeatedly at an interval, starting after the
+// first interval. Intervals which are missed are skipped, and nil is
+// returned if the interval is not positive
+func (s *Scheduler) Every(d time.Duration, state graph.State) *Job {
+	if d <= 0 {
+		return nil
+	}
+	return s.schedule(&Job{state: state, next: time.Now().Add(d), every: d})
+}
+
+// Cron emits a state repeatedly at times which match a cron expression
+// in local time. It returns ErrBadCron if the expression is not valid
+func (s *Scheduler) Cron(expr string, state graph.State) (*Job, error) {
+	c, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	next := c.Next(time.Now())
+	if next.IsZero() {
+		return nil, fmt.Errorf("%w: %q never matches", ErrBadCron, expr)
+	}
+	return s.schedule(&Job{state: state, next: next, cron: c}), nil
+}
+
+// Jobs returns the scheduled jobs
+func (s *Scheduler) Jobs() []*Job {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	result := make([]*Job, len(s.jobs))
+	copy(result, s.jobs)
+	return result
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (s *Scheduler) String() string {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	str := "<scheduler"
+	str += fmt.Sprint(" jobs=", len(s.jobs))
+	if len(s.jobs) > 0 {
+		str += fmt.Sprintf(" next=%v", s.jobs[0].next.Format(time.RFC3339))
+	}
+	return str + ">"
+}
+
+/////////////////////////////////////////////////////////////////////
+// PRIVATE METHODS
+
+// schedule adds a job and wakes the scheduler
+func (s *Scheduler) schedule(j *Job) *Job {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	j.s = s
+	heap.Push(&s.jobs, j)
+	s.notify()
+	return j
+}
+
+// cancel removes a job and returns true if it was scheduled
+func (s *Scheduler) cancel(j *Job) bool {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if j.index < 0 {
+		return false
+	}
+	heap.Remove(&s.jobs, j.index)
+	s.notify()
+	return true
+}
+
+// due returns jobs which are due at t, and reschedules those which
+// repeat
+func (s *Scheduler) due(t time.Time) []*Job {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	var result []*Job
+	for len(s.jobs) > 0 && s.jobs[0].next.After(t) == false {
+		j := s.jobs[0]
+		result = append(result, j)
+		if j.reschedule(t) {
+			heap.Fix(&s.jobs, 0)
+		} else {
+			heap.Pop(&s.jobs)
+		}
+	}
+	return result
+}
+
+// wait returns the duration until the next job, or false if there
+// are no jobs
+func (s *Scheduler) wait(t time.Time) (time.Duration, bool) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	if len(s.jobs) == 0 {
+		return 0, false
+	} else {
+		return s.jobs[0].next.Sub(t), true
+	}
+}
+
+// notify wakes the scheduler without blocking. It should be called
+// whilst holding the lock
+func (s *Scheduler) notify() {
+	if s.wake == nil {
+		s.wake = make(chan struct{}, 1)
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,105 @@
+package graph
+
+import (
+	"fmt"
+	"time"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// EventStats are counters for the events unit, which are returned by
+// the Stats method and emitted periodically as the value of a state
+// with the name EventsStats when enabled
+type EventStats struct {
+	Queued      int                   // States waiting to be dispatched
+	Topics      map[string]TopicStats // Counters for each state name
+	Subscribers []SubscriberStats     // Counters for each subscriber
+	Latency     Histogram             // Time from emit until dispatched to all subscribers
+}
+
+// TopicStats are counters for states with the same name
+type TopicStats struct {
+	Emitted   uint64 // States accepted for dispatch
+	Delivered uint64 // States received by a subscriber
+	Dropped   uint64 // States not received by a subscriber
+}
+
+// SubscriberStats are counters for a subscriber
+type SubscriberStats struct {
+	Topics    []string // Topics, or empty when subscribed to all states
+	Buffer    int      // Size of the channel buffer
+	Lag       int      // States in the buffer which have not been received
+	Delivered uint64   // States sent to the subscriber
+	Dropped   uint64   // States discarded due to the overflow policy
+}
+
+// Histogram counts durations in buckets, where Counts[i] is the number
+// of durations less than or equal to Bounds[i], and the last count is
+// the number of durations greater than every bound
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64        // Number of durations
+	Sum    time.Duration // Sum of durations
+}
+
+/////////////////////////////////////////////////////////////////////
+// CONSTANTS
+
+// EventsStats is the name of the state emitted periodically by the
+// events unit, where the value of the state is EventStats
+const (
+	EventsStats = "graph.EventsStats"
+)
+
+// OtherTopics is the name in EventStats.Topics which counts states with
+// names which are not counted separately, once the events unit is
+// counting the maximum number of names
+const (
+	OtherTopics = "graph.OtherTopics"
+)
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// Mean returns the mean duration, or zero if there are no durations
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	} else {
+		return h.Sum / time.Duration(h.Count)
+	}
+}
+
+// Quantile returns the upper bound of the bucket which contains the
+// quantile q, between 0 and 1. It returns the largest bound when the
+// quantile is greater than every bound
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 || len(h.Bounds) == 0 {
+		return 0
+	}
+	rank, n := uint64(q*float64(h.Count)), uint64(0)
+	for i, bound := range h.Bounds {
+		if n += h.Counts[i]; n > rank {
+			return bound
+		}
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+/////////////////////////////////////////////////////////////////////
+// STRINGIFY
+
+func (s EventStats) String() string {
+	str := "<events"
+	str += fmt.Sprint(" queued=", s.Queued)
+	str += fmt.Sprint(" topics=", len(s.Topics))
+	str += fmt.Sprint(" subscribers=", len(s.Subscribers))
+	str += fmt.Sprint(" latency=", s.Latency)
+	return str + ">"
+}
+
+func (h Histogram) String() string {
+	return fmt.Sprintf("<histogram count=%v mean=%v p99=%v>", h.Count, h.Mean(), h.Quantile(0.99))
+}
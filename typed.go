@@ -0,0 +1,76 @@
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+/////////////////////////////////////////////////////////////////////
+// TYPES
+
+// typed is a state emitted by EmitTyped, where the name is derived
+// from the type of the value
+type typed[T any] struct {
+	v T
+}
+
+/////////////////////////////////////////////////////////////////////
+// PUBLIC METHODS
+
+// TypedTopic returns the name of states emitted by EmitTyped for
+// values of type T
+func TypedTopic[T any]() string {
+	return fmt.Sprint("typed:", reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// EmitTyped emits a value of type T, which is received by subscribers
+// for the type
+func EmitTyped[T any](events Events, v T) {
+	events.Emit(&typed[T]{v})
+}
+
+// SubscribeTyped returns a channel which receives values of type T
+// emitted with EmitTyped, and a function which unsubscribes and closes
+// the channel
+func SubscribeTyped[T any](events Events) (<-chan T, func()) {
+	ch := events.SubscribeTopic(TypedTopic[T]())
+	out := make(chan T)
+	done := make(chan struct{})
+
+	// Receive values until unsubscribed
+	go func() {
+		defer close(out)
+		for s := range ch {
+			v, ok := s.Value().(T)
+			if ok == false {
+				continue
+			}
+			select {
+			case out <- v:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Return channel and function to unsubscribe
+	var once sync.Once
+	return out, func() {
+		once.Do(func() {
+			close(done)
+			events.Unsubscribe(ch)
+		})
+	}
+}
+
+/////////////////////////////////////////////////////////////////////
+// STATE
+
+func (*typed[T]) Name() string {
+	return TypedTopic[T]()
+}
+
+func (t *typed[T]) Value() interface{} {
+	return t.v
+}